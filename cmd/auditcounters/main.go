@@ -0,0 +1,63 @@
+// Command auditcounters checks the denormalized counters in the MyBooru database against the
+// data they count and optionally repairs them.
+//
+// Usage:
+//
+//	auditcounters [-fix] [-db path]
+//
+// It exits with status 1 if discrepancies were found and left unrepaired.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"mybooru/internal/database"
+	"mybooru/internal/fileops"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "repair the discrepancies that are found")
+	dbPath := flag.String("db", "", "path to the database (defaults to the app's database)")
+	flag.Parse()
+
+	if *dbPath == "" {
+		paths, err := fileops.GetAppPaths()
+		if err != nil {
+			log.Fatal("Failed to locate app directory:", err)
+		}
+		*dbPath = paths.DB
+	}
+
+	if _, err := os.Stat(*dbPath); err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+
+	db, err := database.InitDB(*dbPath)
+	if err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+	defer db.Close()
+
+	audit, err := db.AuditCounters(*fix)
+	if err != nil {
+		log.Fatal("Failed to audit counters:", err)
+	}
+
+	for _, d := range audit.Discrepancies {
+		fmt.Printf("%s %d %s: stored %d, actual %d\n", d.Table, d.ID, d.Column, d.Stored, d.Actual)
+	}
+
+	switch {
+	case len(audit.Discrepancies) == 0:
+		fmt.Println("All counters are consistent")
+	case audit.Fixed:
+		fmt.Printf("Repaired %d discrepancies\n", len(audit.Discrepancies))
+	default:
+		fmt.Printf("Found %d discrepancies; run with -fix to repair them\n", len(audit.Discrepancies))
+		db.Close()
+		os.Exit(1)
+	}
+}
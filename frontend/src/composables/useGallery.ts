@@ -45,6 +45,10 @@ const useGallery = () => {
         null,
         null,
       );
+      // A random order is reshuffled on every search, so later pages pin the seed of the first
+      if (result.RandomSeed) {
+        activeQuery += ` /order:random:${result.RandomSeed}`;
+      }
       state.pageIndex = 0;
       state.searchResults = result;
     } catch (error) {
@@ -2,13 +2,18 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 
 	"mybooru/internal/database"
 	"mybooru/internal/fileops"
 	"mybooru/internal/models"
 	"mybooru/internal/server"
 	"mybooru/internal/ui"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type App struct {
@@ -28,11 +33,17 @@ func NewApp(db *database.DB, paths fileops.AppPaths, config *models.Config, serv
 	}
 }
 
+// GetConfig returns a copy of the config without the safe mode PIN hash
 func (a *App) GetConfig() *models.Config {
-	return a.config
+	config := a.config.Snapshot()
+	config.SafeModePIN = ""
+	return config
 }
 
 func (a *App) UpdateConfig(config *models.Config) error {
+	if _, diagnostics := ui.ParseBlacklist(config.Blacklist); len(diagnostics) > 0 {
+		return fmt.Errorf("%w: %s", database.ErrInvalidInput, diagnostics[0].Message)
+	}
 	return a.config.ModifyConfig(config, a.paths.Config)
 }
 
@@ -53,79 +64,439 @@ func (a *App) Shutdown(ctx context.Context) {
 	a.ctx = nil
 }
 
-// GetMediaByID retrieves a single media item by ID
+// EnableSafeMode restricts every search and media lookup to the given ratings until
+// UnlockSafeMode is called with the same PIN
+func (a *App) EnableSafeMode(ratings []models.Rating, pin string) error {
+	return a.config.EnableSafeMode(ratings, pin, a.paths.Config)
+}
+
+// UnlockSafeMode turns safe mode off if the PIN is correct
+func (a *App) UnlockSafeMode(pin string) error {
+	return a.config.DisableSafeMode(pin, a.paths.Config)
+}
+
+// GetMediaByID retrieves a single media item by ID. Media hidden by safe mode are reported as not found.
 func (a *App) GetMediaByID(id int64) (*models.Media, error) {
-	return a.db.GetMediaByID(id)
+	media, err := a.db.GetMediaByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !a.config.AllowsRating(media.Rating) {
+		return nil, database.ErrNotFound
+	}
+	return media, nil
 }
 
-// GetTagsByMediaID retrieves tags for a media item
+// GetTagsByMediaID retrieves tags for a media item. Media hidden by safe mode are reported as not found.
 func (a *App) GetTagsByMediaID(mediaID int64) ([]*models.Tag, error) {
+	if _, err := a.GetMediaByID(mediaID); err != nil {
+		return nil, err
+	}
 	return a.db.GetTagsByMediaID(mediaID)
 }
 
+// SearchTags suggests tags for a partially typed tag name. A leading '-' or '~' is ignored
+// so that suggestions keep working while typing search modifiers.
+func (a *App) SearchTags(pattern string, limit int) ([]*models.TagSuggestion, error) {
+	return a.db.SearchTags(strings.TrimLeft(pattern, "-~"), limit)
+}
+
 func (a *App) GetApiPort() int {
 	return a.server.GetPort()
 }
 
 func (a *App) SearchMedia(searchString string, limit int, offset int, beforeID *int64, afterID *int64) (*models.SearchResult, error) {
-	query := ui.ParseQuery(searchString)
+	query, diagnostics, savedIDs := a.parseSearch(searchString)
 	query.Limit = limit
 	query.Offset = offset
 	query.BeforeID = beforeID
 	query.AfterID = afterID
-	return a.db.GetMediaBySearch(query)
-}
 
-func (a *App) UpdateMediaTags(mediaID int64, tagString string) error {
-	newTags, err := ui.ParseTags(tagString)
+	result, err := a.db.GetMediaBySearch(query)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	result.Diagnostics = diagnostics
+	result.Corrections = a.suggestCorrections(searchString)
+	a.recordSearch(searchString, int(result.TotalCount))
+	a.touchSavedSearches(savedIDs)
+	return result, nil
+}
+
+// SearchMediaByCursor pages through search results using the opaque cursors of a previous SearchResult.
+// Pass LastCursor as beforeCursor for the next page, or FirstCursor as afterCursor for the previous page.
+func (a *App) SearchMediaByCursor(searchString string, limit int, beforeCursor string, afterCursor string) (*models.SearchResult, error) {
+	query, diagnostics, savedIDs := a.parseSearch(searchString)
+	query.Limit = limit
+	query.BeforeCursor = beforeCursor
+	query.AfterCursor = afterCursor
 
-	oldTags, err := a.db.GetTagsByMediaID(mediaID)
+	result, err := a.db.GetMediaBySearch(query)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	result.Diagnostics = diagnostics
+	result.Corrections = a.suggestCorrections(searchString)
+	a.recordSearch(searchString, int(result.TotalCount))
+	a.touchSavedSearches(savedIDs)
+	return result, nil
+}
 
-	// Create map of new tags for O(1) lookup
-	newTagMap := make(map[string]bool)
-	for _, t := range newTags {
-		newTagMap[t.Name] = true
-	}
+// maxTagCorrections is the number of replacements offered for each unknown search term
+const maxTagCorrections = 3
 
-	// Create map of old tags
-	oldTagMap := make(map[string]int64)
-	for _, t := range oldTags {
-		oldTagMap[t.Name] = t.ID
+// suggestCorrections offers replacements for the tags a search includes that don't exist, since
+// those make the search come up empty. Failures are only logged, as with recordSearch.
+func (a *App) suggestCorrections(searchString string) []models.TagCorrection {
+	corrections := []models.TagCorrection{}
+	for _, term := range ui.ParseTagTerms(searchString) {
+		if term.Negated {
+			continue
+		}
+		suggestions, err := a.db.SuggestTagCorrections(term.Name, maxTagCorrections)
+		if err != nil {
+			log.Printf("Failed to suggest corrections for %s: %v", term.Name, err)
+			return corrections
+		}
+		if suggestions == nil {
+			continue
+		}
+		corrections = append(corrections, models.TagCorrection{
+			Offset:      term.Offset,
+			Length:      term.Length,
+			Term:        term.Name,
+			Suggestions: suggestions,
+		})
 	}
+	return corrections
+}
+
+// parseSearch parses a search string, expanding saved searches and applying the configured
+// blacklist and safe mode. It also returns the IDs of the saved searches that were expanded, to be
+// marked as used once the search has run.
+func (a *App) parseSearch(searchString string) (*models.SearchQuery, []models.QueryDiagnostic, []int64) {
+	var savedIDs []int64
+	query, diagnostics := ui.ParseQueryWithSavedSearches(searchString, a.savedSearchResolver(&savedIDs))
+	// Entries are validated when the config is saved, so problems here come from a hand-edited file
+	// and are skipped rather than reported against the user's query
+	query.Blacklist, _ = ui.ParseBlacklist(a.config.Snapshot().Blacklist)
+	query.AllowedRatings = a.config.AllowedRatings()
+	return query, diagnostics, savedIDs
+}
 
-	// Tags to add
-	var toAdd []models.CreateTagInput
-	for _, t := range newTags {
-		if _, exists := oldTagMap[t.Name]; !exists {
-			toAdd = append(toAdd, t)
+// NormalizeQuery rewrites a search string into its canonical form, which matches the same media
+// and is the same for every way of writing the same search, except that aliases are kept as written
+func (a *App) NormalizeQuery(searchString string) string {
+	query, _ := ui.ParseQueryWithSavedSearches(searchString, a.savedSearchResolver(nil))
+	return ui.FormatQuery(query)
+}
+
+// savedSearchResolver looks up the query of a saved search for /saved:name references, adding the
+// IDs of the saved searches it finds to used unless that is nil
+func (a *App) savedSearchResolver(used *[]int64) ui.SavedSearchResolver {
+	return func(name string) (string, bool) {
+		saved, err := a.db.GetSavedSearchByName(name)
+		if err != nil {
+			if !errors.Is(err, database.ErrNotFound) {
+				log.Printf("Failed to look up saved search %s: %v", name, err)
+			}
+			return "", false
+		}
+		if used != nil {
+			*used = append(*used, saved.ID)
 		}
+		return saved.Query, true
 	}
+}
 
-	// Tags to remove
-	var toRemove []int64
-	for _, t := range oldTags {
-		if !newTagMap[t.Name] {
-			toRemove = append(toRemove, t.ID)
+// touchSavedSearches marks saved searches as just used. Like recordSearch, failures are only
+// logged, since the search they were part of has already succeeded.
+func (a *App) touchSavedSearches(ids []int64) {
+	for _, id := range ids {
+		if err := a.db.TouchSavedSearch(id); err != nil {
+			log.Printf("Failed to mark saved search %d as used: %v", id, err)
 		}
 	}
+}
+
+// GetSavedSearches lists all saved searches
+func (a *App) GetSavedSearches() ([]*models.SavedSearch, error) {
+	return a.db.GetSavedSearches()
+}
+
+// CreateSavedSearch saves a query under a name that can be run directly or referenced as /saved:name
+func (a *App) CreateSavedSearch(name string, query string) (int64, error) {
+	return a.db.CreateSavedSearch(strings.TrimSpace(name), strings.TrimSpace(query))
+}
 
-	if len(toAdd) > 0 {
-		if err := a.db.AddTagsToMediaTx(mediaID, toAdd); err != nil {
-			return err
+// RenameSavedSearch changes the name of a saved search
+func (a *App) RenameSavedSearch(id int64, name string) error {
+	return a.db.RenameSavedSearch(id, strings.TrimSpace(name))
+}
+
+// UpdateSavedSearch replaces the query of a saved search
+func (a *App) UpdateSavedSearch(id int64, query string) error {
+	return a.db.UpdateSavedSearch(id, strings.TrimSpace(query))
+}
+
+// DeleteSavedSearch removes a saved search
+func (a *App) DeleteSavedSearch(id int64) error {
+	return a.db.DeleteSavedSearch(id)
+}
+
+// RunSavedSearch runs a saved search by name and marks it as used if the search succeeds
+func (a *App) RunSavedSearch(name string, limit int, offset int) (*models.SearchResult, error) {
+	saved, err := a.db.GetSavedSearchByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := a.SearchMedia(saved.Query, limit, offset, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	a.touchSavedSearches([]int64{saved.ID})
+	return result, nil
+}
+
+// GetRelatedTags returns the tags that occur most often among all media matching a search,
+// grouped by category with at most limit tags each
+func (a *App) GetRelatedTags(searchString string, limit int) ([]*models.RelatedTagGroup, error) {
+	query, _, _ := a.parseSearch(searchString)
+	return a.db.GetRelatedTags(query, limit)
+}
+
+// GetSearchFacets breaks all media matching a search down by rating, media type, favorite and
+// file extension, with the refined search string for each value
+func (a *App) GetSearchFacets(searchString string) (*models.SearchFacets, error) {
+	query, _, _ := a.parseSearch(searchString)
+	facets, err := a.db.GetSearchFacets(query)
+	if err != nil {
+		return nil, err
+	}
+
+	for filter, values := range map[string][]models.FacetValue{
+		"rating":   facets.Rating,
+		"type":     facets.MediaType,
+		"favorite": facets.Favorite,
+		"ext":      facets.Extension,
+	} {
+		for i := range values {
+			values[i].Query, _ = ui.RefineQuery(searchString, filter, values[i].Value)
 		}
 	}
 
-	for _, tagID := range toRemove {
-		if err := a.db.RemoveTagFromMedia(mediaID, tagID); err != nil {
-			return err
+	return facets, nil
+}
+
+// recordSearch adds a search to the history unless recording is turned off.
+// Failures are only logged, since they shouldn't fail the search itself.
+func (a *App) recordSearch(searchString string, resultCount int) {
+	searchString = strings.TrimSpace(searchString)
+	if !a.config.Snapshot().RecordSearchHistory || searchString == "" {
+		return
+	}
+	if err := a.db.RecordSearch(searchString, resultCount); err != nil {
+		log.Printf("Failed to record search history: %v", err)
+	}
+}
+
+// GetRecentSearches lists the most recent searches, newest first. The history isn't limited by
+// rating, so it is empty while safe mode is on.
+func (a *App) GetRecentSearches(limit int) ([]*models.SearchHistory, error) {
+	if a.config.AllowedRatings() != nil {
+		return []*models.SearchHistory{}, nil
+	}
+	return a.db.GetRecentSearches(limit)
+}
+
+// GetFrequentSearches lists the most often run searches. Like GetRecentSearches, it is empty
+// while safe mode is on.
+func (a *App) GetFrequentSearches(limit int) ([]*models.SearchFrequency, error) {
+	if a.config.AllowedRatings() != nil {
+		return []*models.SearchFrequency{}, nil
+	}
+	return a.db.GetFrequentSearches(limit)
+}
+
+// DeleteSearchHistory removes a single entry from the search history, unless safe mode is on
+func (a *App) DeleteSearchHistory(id int64) error {
+	if a.config.AllowedRatings() != nil {
+		return models.ErrSafeModeLocked
+	}
+	return a.db.DeleteSearchHistory(id)
+}
+
+// ClearSearchHistory removes every entry from the search history, unless safe mode is on
+func (a *App) ClearSearchHistory() error {
+	if a.config.AllowedRatings() != nil {
+		return models.ErrSafeModeLocked
+	}
+	return a.db.ClearSearchHistory()
+}
+
+// UpdateMediaTags replaces the tags of a media item with the tags in tagString, all at once,
+// and returns what was added, removed and recategorized. Media hidden by safe mode are
+// reported as not found.
+func (a *App) UpdateMediaTags(mediaID int64, tagString string) (*models.MediaTagChanges, error) {
+	if _, err := a.GetMediaByID(mediaID); err != nil {
+		return nil, err
+	}
+
+	tags, err := ui.ParseTags(tagString)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.db.SetMediaTags(mediaID, tags)
+}
+
+// GetTagAliases lists all tag aliases
+func (a *App) GetTagAliases() ([]*models.TagAlias, error) {
+	return a.db.GetTagAliases()
+}
+
+// CreateTagAlias makes antecedent an alias of consequent. If migrate is set, the antecedent tag's
+// media and implications move to consequent and the antecedent tag is deleted.
+func (a *App) CreateTagAlias(antecedent string, consequent string, migrate bool) (int64, error) {
+	antecedent = strings.ToLower(strings.TrimSpace(antecedent))
+	consequent = strings.ToLower(strings.TrimSpace(consequent))
+
+	if err := ui.ValidateTagName(antecedent); err != nil {
+		return 0, err
+	}
+	if err := ui.ValidateTagName(consequent); err != nil {
+		return 0, err
+	}
+
+	return a.db.CreateTagAlias(antecedent, consequent, migrate)
+}
+
+// DeleteTagAlias removes a tag alias
+func (a *App) DeleteTagAlias(id int64) error {
+	return a.db.DeleteTagAlias(id)
+}
+
+// GetTagImplications lists all tag implications
+func (a *App) GetTagImplications() ([]*models.TagImplication, error) {
+	return a.db.GetTagImplications()
+}
+
+// CreateTagImplication makes the child tag imply the parent tag, creating either tag if needed.
+// Tag names may carry a category prefix such as "character:miku". If applyExisting is set,
+// media that already have the child tag are retagged as well.
+func (a *App) CreateTagImplication(child string, parent string, applyExisting bool) (int64, error) {
+	tags, err := ui.ParseTags(child + " " + parent)
+	if err != nil {
+		return 0, err
+	}
+	if len(tags) != 2 {
+		return 0, fmt.Errorf("%w: expected one child and one parent tag", database.ErrInvalidInput)
+	}
+
+	id, err := a.db.CreateTagImplicationByName(tags[0], tags[1])
+	if err != nil {
+		return 0, err
+	}
+
+	if applyExisting {
+		if _, err := a.db.ApplyTagImplication(id); err != nil {
+			return id, err
 		}
 	}
 
-	return nil
+	return id, nil
+}
+
+// ApplyTagImplication retags existing media according to an implication, returning the number of tags added
+func (a *App) ApplyTagImplication(id int64) (int64, error) {
+	return a.db.ApplyTagImplication(id)
+}
+
+// DeleteTagImplication removes a tag implication
+func (a *App) DeleteTagImplication(id int64) error {
+	return a.db.DeleteTagImplication(id)
+}
+
+// RenameTag renames the tag called oldName to newName
+func (a *App) RenameTag(oldName string, newName string) error {
+	newName = strings.ToLower(strings.TrimSpace(newName))
+	if err := ui.ValidateTagName(newName); err != nil {
+		return err
+	}
+
+	tag, err := a.db.GetTagByName(strings.TrimSpace(oldName))
+	if err != nil {
+		return err
+	}
+
+	return a.db.RenameTag(tag.ID, newName)
+}
+
+// MergeTags merges the tag called from into the tag called into, retagging its media.
+// If leaveAlias is set, from becomes an alias of into.
+func (a *App) MergeTags(from string, into string, leaveAlias bool) error {
+	fromTag, err := a.db.GetTagByName(strings.TrimSpace(from))
+	if err != nil {
+		return err
+	}
+	intoTag, err := a.db.GetTagByName(strings.TrimSpace(into))
+	if err != nil {
+		return err
+	}
+
+	return a.db.MergeTags(fromTag.ID, intoTag.ID, leaveAlias)
+}
+
+// SetTagCategory moves the named tag to another category
+func (a *App) SetTagCategory(name string, category models.TagCategory) error {
+	tag, err := a.db.GetTagByName(strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+
+	return a.db.SetTagCategory(tag.ID, category)
+}
+
+// AuditCounters checks the denormalized tag counts, usage counts and has_children flags
+// against the data they count, repairing them if fix is set
+func (a *App) AuditCounters(fix bool) (*models.CounterAudit, error) {
+	return a.db.AuditCounters(fix)
+}
+
+// BulkEditTags applies a tag delta such as "+landscape -wip artist:foo" to every media item
+// matching searchString, as limited by the blacklist and safe mode. With dryRun set it only counts
+// the matching media. Progress is reported through "bulk-edit-progress" events carrying the number
+// of media done and the total. A search without conditions is only applied if allMedia is set.
+func (a *App) BulkEditTags(searchString string, delta string, dryRun bool, allMedia bool) (*models.BulkTagEdit, error) {
+	query, diagnostics, _ := a.parseSearch(searchString)
+	if len(diagnostics) > 0 {
+		return nil, fmt.Errorf("%w: %s", database.ErrInvalidInput, diagnostics[0].Message)
+	}
+
+	tagDelta, err := ui.ParseTagDelta(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.db.BulkEditTags(query, tagDelta, models.BulkEditOptions{
+		DryRun:      dryRun,
+		AllMedia:    allMedia,
+		Description: strings.TrimSpace(searchString) + ": " + strings.TrimSpace(delta),
+		Progress: func(done, total int) {
+			if a.ctx != nil {
+				runtime.EventsEmit(a.ctx, "bulk-edit-progress", done, total)
+			}
+		},
+	})
+}
+
+// GetBulkTagEdits lists the most recent bulk tag edits, newest first
+func (a *App) GetBulkTagEdits(limit int) ([]*models.BulkTagEdit, error) {
+	return a.db.GetBulkTagEdits(limit)
+}
+
+// UndoBulkTagEdit reverses a bulk tag edit
+func (a *App) UndoBulkTagEdit(id int64) error {
+	return a.db.UndoBulkTagEdit(id)
 }
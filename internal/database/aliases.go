@@ -0,0 +1,215 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"mybooru/internal/models"
+)
+
+// aliasLookupSQL resolves a tag name through tag_aliases, falling back to the name itself
+const aliasLookupSQL = `COALESCE((SELECT consequent_name FROM tag_aliases WHERE antecedent_name = ? COLLATE NOCASE), ?)`
+
+// GetTagAliases retrieves all tag aliases ordered by antecedent name
+func (db *DB) GetTagAliases() ([]*models.TagAlias, error) {
+	query := `
+		SELECT id, antecedent_name, consequent_name, created_at
+		FROM tag_aliases
+		ORDER BY antecedent_name COLLATE NOCASE
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, WrapQueryError("tag aliases", err)
+	}
+	defer rows.Close()
+
+	var aliases []*models.TagAlias
+	for rows.Next() {
+		alias := &models.TagAlias{}
+		if err := rows.Scan(&alias.ID, &alias.AntecedentName, &alias.ConsequentName, &alias.CreatedAt); err != nil {
+			return nil, WrapScanError("tag alias", err)
+		}
+		aliases = append(aliases, alias)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("tag alias", err)
+	}
+
+	return aliases, nil
+}
+
+// GetTagAliasByAntecedent retrieves the alias for a tag name (case-insensitive)
+func (db *DB) GetTagAliasByAntecedent(name string) (*models.TagAlias, error) {
+	query := `
+		SELECT id, antecedent_name, consequent_name, created_at
+		FROM tag_aliases
+		WHERE antecedent_name = ? COLLATE NOCASE
+	`
+
+	alias := &models.TagAlias{}
+	err := db.QueryRow(query, name).Scan(&alias.ID, &alias.AntecedentName, &alias.ConsequentName, &alias.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, WrapGetByNameError("tag alias", err)
+	}
+
+	return alias, nil
+}
+
+// CreateTagAlias makes antecedent an alias of consequent, so that tagging or searching for
+// antecedent uses consequent instead. Aliases may not be chained: consequent cannot itself be
+// an alias, and antecedent cannot already be the target of another alias.
+// If migrate is set, an existing antecedent tag is folded into consequent the way MergeTags does:
+// its media are retagged, its implications are moved over and the tag itself is deleted.
+func (db *DB) CreateTagAlias(antecedent, consequent string, migrate bool) (int64, error) {
+	if antecedent == "" || consequent == "" {
+		return 0, fmt.Errorf("%w: alias names cannot be empty", ErrInvalidInput)
+	}
+	if strings.EqualFold(antecedent, consequent) {
+		return 0, fmt.Errorf("%w: tag %s cannot be an alias of itself", ErrInvalidInput, antecedent)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	// The UNIQUE constraint on antecedent_name is case-sensitive, so check for duplicates here
+	var existing string
+	err = tx.QueryRow("SELECT antecedent_name FROM tag_aliases WHERE antecedent_name = ? COLLATE NOCASE", antecedent).Scan(&existing)
+	if err == nil {
+		return 0, fmt.Errorf("%w: alias for %s already exists", ErrConstraintViolation, existing)
+	}
+	if err != sql.ErrNoRows {
+		return 0, WrapQueryError("tag aliases", err)
+	}
+
+	err = tx.QueryRow("SELECT antecedent_name FROM tag_aliases WHERE antecedent_name = ? COLLATE NOCASE", consequent).Scan(&existing)
+	if err == nil {
+		return 0, fmt.Errorf("%w: %s is already an alias and cannot be an alias target", ErrConstraintViolation, consequent)
+	}
+	if err != sql.ErrNoRows {
+		return 0, WrapQueryError("tag aliases", err)
+	}
+
+	err = tx.QueryRow("SELECT antecedent_name FROM tag_aliases WHERE consequent_name = ? COLLATE NOCASE LIMIT 1", antecedent).Scan(&existing)
+	if err == nil {
+		return 0, fmt.Errorf("%w: %s is the target of alias %s and cannot itself be aliased", ErrConstraintViolation, antecedent, existing)
+	}
+	if err != sql.ErrNoRows {
+		return 0, WrapQueryError("tag aliases", err)
+	}
+
+	result, err := tx.Exec("INSERT INTO tag_aliases (antecedent_name, consequent_name, created_at) VALUES (?, ?, ?)",
+		antecedent, consequent, time.Now().Unix())
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return 0, fmt.Errorf("%w: alias for %s already exists", ErrConstraintViolation, antecedent)
+		}
+		return 0, WrapCreateError("tag alias", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, WrapLastInsertIDError(err)
+	}
+
+	if migrate {
+		if err := migrateAliasedTagTx(tx, antecedent, consequent); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, WrapTransactionCommitError(err)
+	}
+
+	return id, nil
+}
+
+// migrateAliasedTagTx moves the media and implications of the antecedent tag onto the consequent
+// tag, creating the consequent with the antecedent's category if it doesn't exist yet, and then
+// deletes the antecedent, which can no longer be used once it is an alias
+func migrateAliasedTagTx(tx *sql.Tx, antecedent, consequent string) error {
+	var fromID int64
+	var category models.TagCategory
+	err := tx.QueryRow("SELECT id, category FROM tags WHERE name = ? COLLATE NOCASE", antecedent).Scan(&fromID, &category)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return WrapGetByNameError("tag", err)
+	}
+
+	toID, err := getOrCreateTagIDTx(tx, consequent, category)
+	if err != nil {
+		return err
+	}
+
+	if err := moveMediaTagsTx(tx, fromID, toID); err != nil {
+		return err
+	}
+	if err := moveTagImplicationsTx(tx, fromID, toID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", fromID); err != nil {
+		return WrapDeleteError("tag", err)
+	}
+
+	return nil
+}
+
+// moveMediaTagsTx retags every media item tagged with fromID as toID. Media that already have
+// both tags simply lose fromID. The media_tags triggers keep all counters in step.
+func moveMediaTagsTx(tx *sql.Tx, fromID, toID int64) error {
+	_, err := tx.Exec(`
+		INSERT OR IGNORE INTO media_tags (media_id, tag_id, created_at)
+		SELECT media_id, ?, created_at FROM media_tags WHERE tag_id = ?
+	`, toID, fromID)
+	if err != nil {
+		return WrapExecError("move media tags", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM media_tags WHERE tag_id = ?", fromID); err != nil {
+		return WrapExecError("move media tags", err)
+	}
+
+	return nil
+}
+
+// retargetTagAliasesTx points every alias whose consequent is oldName at newName instead
+func retargetTagAliasesTx(tx *sql.Tx, oldName, newName string) error {
+	_, err := tx.Exec("UPDATE tag_aliases SET consequent_name = ? WHERE consequent_name = ? COLLATE NOCASE", newName, oldName)
+	if err != nil {
+		return WrapUpdateError("tag aliases", err)
+	}
+	return nil
+}
+
+// DeleteTagAlias deletes a tag alias by ID. Media migrated when the alias was created keep their tags.
+func (db *DB) DeleteTagAlias(id int64) error {
+	result, err := db.Exec("DELETE FROM tag_aliases WHERE id = ?", id)
+	if err != nil {
+		return WrapDeleteError("tag alias", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return WrapRowsAffectedError(err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
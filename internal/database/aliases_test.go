@@ -0,0 +1,181 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"mybooru/internal/models"
+)
+
+func TestCreateTagAlias(t *testing.T) {
+	db := SetupTestDB(t)
+
+	_, err := db.CreateTagAlias("kitty", "cat", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	tests := []struct {
+		name       string
+		antecedent string
+		consequent string
+		wantErr    error
+	}{
+		{name: "duplicate antecedent", antecedent: "KITTY", consequent: "kitten", wantErr: ErrConstraintViolation},
+		{name: "alias to an alias", antecedent: "kitten", consequent: "kitty", wantErr: ErrConstraintViolation},
+		{name: "alias a consequent", antecedent: "cat", consequent: "feline", wantErr: ErrConstraintViolation},
+		{name: "alias to itself", antecedent: "dog", consequent: "Dog", wantErr: ErrInvalidInput},
+		{name: "empty name", antecedent: "", consequent: "dog", wantErr: ErrInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.CreateTagAlias(tt.antecedent, tt.consequent, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	aliases, err := db.GetTagAliases()
+	AssertNoError(t, err, "GetTagAliases failed")
+	AssertEqual(t, len(aliases), 1, "alias count mismatch")
+
+	alias, err := db.GetTagAliasByAntecedent("Kitty")
+	AssertNoError(t, err, "GetTagAliasByAntecedent failed")
+	AssertEqual(t, alias.ConsequentName, "cat", "consequent mismatch")
+
+	AssertNoError(t, db.DeleteTagAlias(alias.ID), "DeleteTagAlias failed")
+	_, err = db.GetTagAliasByAntecedent("kitty")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if !errors.Is(db.DeleteTagAlias(alias.ID), ErrNotFound) {
+		t.Error("deleting a missing alias should return ErrNotFound")
+	}
+}
+
+func TestTaggingFollowsAliases(t *testing.T) {
+	db := SetupTestDB(t)
+
+	_, err := db.CreateTagAlias("kitty", "cat", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	id := createTestMedia(t, db, "kitty", "cat", "dog")
+
+	tags, err := db.GetTagsByMediaID(id)
+	AssertNoError(t, err, "GetTagsByMediaID failed")
+	AssertEqual(t, tagNames(tags), []string{"cat", "dog"}, "aliased tag should be stored as its consequent")
+
+	_, err = db.GetTagByName("kitty")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("antecedent tag should not be created, got %v", err)
+	}
+}
+
+func TestSearchFollowsAliases(t *testing.T) {
+	db := SetupTestDB(t)
+
+	cat := createTestMedia(t, db, "cat")
+	dog := createTestMedia(t, db, "dog")
+	_, err := db.CreateTagAlias("kitty", "cat", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{query: "kitty", want: []int64{cat}},
+		{query: "KITTY", want: []int64{cat}},
+		{query: "-kitty", want: []int64{dog}},
+		{query: "~kitty ~dog", want: []int64{dog, cat}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			AssertEqual(t, searchIDs(t, db, parseQuery(t, tt.query)), tt.want, "search results mismatch")
+		})
+	}
+}
+
+func TestCreateTagAliasMigratesMediaTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	both := createTestMedia(t, db, "kitty", "cat")
+	onlyAntecedent := createTestMedia(t, db, "kitty")
+	AssertNoError(t, db.AddTagsToMediaTx(onlyAntecedent, []models.CreateTagInput{
+		{Name: "some_artist", Category: models.TagCategoryArtist},
+	}), "AddTagsToMediaTx failed")
+	_, err := db.CreateTag(&models.CreateTagInput{Name: "old_artist", Category: models.TagCategoryArtist})
+	AssertNoError(t, err, "CreateTag failed")
+	AssertNoError(t, db.AddTagsToMediaTx(both, []models.CreateTagInput{{Name: "old_artist"}}), "AddTagsToMediaTx failed")
+
+	_, err = db.CreateTagAlias("kitty", "cat", true)
+	AssertNoError(t, err, "CreateTagAlias failed")
+	_, err = db.CreateTagAlias("old_artist", "new_artist", true)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	for _, id := range []int64{both, onlyAntecedent} {
+		media, err := db.GetMediaByID(id)
+		AssertNoError(t, err, "GetMediaByID failed")
+		AssertEqual(t, media.TagCount, 2, "tag count should reflect migrated tags")
+	}
+
+	tags, err := db.GetTagsByMediaID(both)
+	AssertNoError(t, err, "GetTagsByMediaID failed")
+	AssertEqual(t, tagNames(tags), []string{"cat", "new_artist"}, "media tags should be migrated")
+
+	_, err = db.GetTagByName("kitty")
+	AssertEqual(t, err, ErrNotFound, "the emptied antecedent tag should be deleted")
+
+	cat, err := db.GetTagByName("cat")
+	AssertNoError(t, err, "GetTagByName failed")
+	AssertEqual(t, cat.UsageCount, 2, "consequent usage count")
+
+	artist, err := db.GetTagByName("new_artist")
+	AssertNoError(t, err, "GetTagByName failed")
+	AssertEqual(t, artist.Category, models.TagCategoryArtist, "created consequent should keep the antecedent's category")
+}
+
+func TestCreateTagAliasMigratesImplications(t *testing.T) {
+	db := SetupTestDB(t)
+
+	kitty := createTestTag(t, db, "kitty", models.TagCategoryGeneral)
+	cat := createTestTag(t, db, "cat", models.TagCategoryGeneral)
+	animal := createTestTag(t, db, "animal", models.TagCategoryGeneral)
+	neko := createTestTag(t, db, "neko", models.TagCategoryGeneral)
+	_, err := db.CreateTagImplication(kitty, animal)
+	AssertNoError(t, err, "CreateTagImplication failed")
+	_, err = db.CreateTagImplication(neko, kitty)
+	AssertNoError(t, err, "CreateTagImplication failed")
+
+	_, err = db.CreateTagAlias("kitty", "cat", true)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	implied, err := db.GetImpliedTags(cat)
+	AssertNoError(t, err, "GetImpliedTags failed")
+	AssertEqual(t, tagNames(implied), []string{"animal"}, "the antecedent's implications should move to the consequent")
+
+	implied, err = db.GetImpliedTags(neko)
+	AssertNoError(t, err, "GetImpliedTags failed")
+	AssertEqual(t, tagNames(implied), []string{"animal", "cat"}, "implications of the antecedent should point at the consequent")
+
+	id := createTestMedia(t, db, "neko")
+	tags, err := db.GetTagsByMediaID(id)
+	AssertNoError(t, err, "GetTagsByMediaID failed")
+	AssertEqual(t, tagNames(tags), []string{"animal", "cat", "neko"}, "tagging should follow the moved implications")
+
+	// Folding neko into animal would make animal imply cat, which already implies animal
+	_, err = db.CreateTagAlias("neko", "animal", true)
+	AssertError(t, err, "migrating implications into a cycle should be rejected")
+	_, err = db.GetTagAliasByAntecedent("neko")
+	AssertEqual(t, err, ErrNotFound, "a rejected alias should not be created")
+	_, err = db.GetTagByName("neko")
+	AssertNoError(t, err, "a rejected alias should leave the antecedent tag alone")
+}
+
+func tagNames(tags []*models.Tag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
@@ -0,0 +1,405 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"mybooru/internal/models"
+)
+
+// defaultBulkEditBatchSize is the number of media a bulk tag edit changes per transaction
+const defaultBulkEditBatchSize = 500
+
+// BulkEditTags applies a tag delta to every media item matching query. Tags are added the same
+// way as when tagging a single item, following aliases and implications, and removed tags are
+// looked up through their aliases. The media are edited in batches, each in its own transaction,
+// and every tag actually added or removed is recorded so that UndoBulkTagEdit can reverse it;
+// if a batch fails, the batches before it stay applied and can still be undone.
+// Tags whose category is changed by an explicit category in the delta are recorded too.
+// A query without conditions of its own is rejected unless AllMedia is set.
+// With DryRun set, nothing is changed and only MatchedCount is filled in.
+func (db *DB) BulkEditTags(query *models.SearchQuery, delta models.TagDelta, opts models.BulkEditOptions) (*models.BulkTagEdit, error) {
+	if len(delta.Add) == 0 && len(delta.Remove) == 0 {
+		return nil, fmt.Errorf("%w: no tags to add or remove", ErrInvalidInput)
+	}
+
+	if !opts.DryRun && !opts.AllMedia {
+		unconditional, err := matchesEverything(query)
+		if err != nil {
+			return nil, err
+		}
+		if unconditional {
+			return nil, fmt.Errorf("%w: the query matches every media item; set AllMedia to edit them all", ErrInvalidInput)
+		}
+	}
+
+	mediaIDs, err := db.matchingMediaIDs(query)
+	if err != nil {
+		return nil, err
+	}
+
+	edit := &models.BulkTagEdit{
+		Description:  opts.Description,
+		MatchedCount: int64(len(mediaIDs)),
+		CreatedAt:    time.Now().Unix(),
+	}
+	if opts.DryRun || len(mediaIDs) == 0 {
+		return edit, nil
+	}
+
+	removeIDs, err := db.resolveTagIDs(delta.Remove)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.Exec("INSERT INTO bulk_tag_edits (description, matched_count, created_at) VALUES (?, ?, ?)",
+		edit.Description, edit.MatchedCount, edit.CreatedAt)
+	if err != nil {
+		return nil, WrapCreateError("bulk tag edit", err)
+	}
+	edit.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, WrapLastInsertIDError(err)
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBulkEditBatchSize
+	}
+
+	for start := 0; start < len(mediaIDs); start += batchSize {
+		batch := mediaIDs[start:min(start+batchSize, len(mediaIDs))]
+
+		changed, err := db.bulkEditBatch(edit.ID, batch, delta.Add, removeIDs)
+		if err != nil {
+			return edit, err
+		}
+		edit.ChangedCount += changed
+
+		if opts.Progress != nil {
+			opts.Progress(start+len(batch), len(mediaIDs))
+		}
+	}
+
+	return edit, nil
+}
+
+// matchesEverything reports whether a query has no conditions of its own, leaving aside
+// the blacklist and safe mode which only narrow it
+func matchesEverything(query *models.SearchQuery) (bool, error) {
+	own := *query
+	own.Blacklist = nil
+	own.AllowedRatings = nil
+
+	clauses, _, err := buildSearchConditions(&own)
+	if err != nil {
+		return false, err
+	}
+	return len(clauses) == 0, nil
+}
+
+// matchingMediaIDs lists the IDs of every media item matching query, ignoring paging
+func (db *DB) matchingMediaIDs(query *models.SearchQuery) ([]int64, error) {
+	subquery, args, err := matchingMediaSQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(subquery+" ORDER BY m.id", args...)
+	if err != nil {
+		return nil, WrapQueryError("media", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, WrapScanError("media", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("media", err)
+	}
+
+	return ids, nil
+}
+
+// resolveTagIDs looks up the IDs of the named tags after following their aliases,
+// skipping names that aren't tags
+func (db *DB) resolveTagIDs(names []string) ([]int64, error) {
+	var ids []int64
+	for _, name := range names {
+		var id int64
+		err := db.QueryRow("SELECT id FROM tags WHERE name = "+aliasLookupSQL+" COLLATE NOCASE", name, name).Scan(&id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, WrapGetByNameError("tag", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// bulkEditBatch applies a tag delta to a batch of media in one transaction and records the
+// media_tags rows it added and removed under the bulk edit, along with the previous category of
+// any tag the delta recategorized. It returns the number of media changed.
+func (db *DB) bulkEditBatch(editID int64, mediaIDs []int64, add []models.CreateTagInput, removeIDs []int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	before, err := mediaTagSetsTx(tx, mediaIDs)
+	if err != nil {
+		return 0, err
+	}
+	categories, err := tagCategoriesTx(tx, add)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, mediaID := range mediaIDs {
+		for _, tagID := range removeIDs {
+			if _, err := tx.Exec("DELETE FROM media_tags WHERE media_id = ? AND tag_id = ?", mediaID, tagID); err != nil {
+				return 0, WrapExecError("remove tag from media", err)
+			}
+		}
+		if len(add) > 0 {
+			if err := addTagsToMediaWithTx(tx, mediaID, add); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	after, err := mediaTagSetsTx(tx, mediaIDs)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordBulkCategoryChangesTx(tx, editID, categories); err != nil {
+		return 0, err
+	}
+
+	var changed int64
+	for _, mediaID := range mediaIDs {
+		mediaChanged := false
+		for tagID := range after[mediaID] {
+			if !before[mediaID][tagID] {
+				if err := recordBulkTagChangeTx(tx, editID, mediaID, tagID, true); err != nil {
+					return 0, err
+				}
+				mediaChanged = true
+			}
+		}
+		for tagID := range before[mediaID] {
+			if !after[mediaID][tagID] {
+				if err := recordBulkTagChangeTx(tx, editID, mediaID, tagID, false); err != nil {
+					return 0, err
+				}
+				mediaChanged = true
+			}
+		}
+		if mediaChanged {
+			changed++
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE bulk_tag_edits SET changed_count = changed_count + ? WHERE id = ?", changed, editID); err != nil {
+		return 0, WrapUpdateError("bulk tag edit", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, WrapTransactionCommitError(err)
+	}
+
+	return changed, nil
+}
+
+// mediaTagSetsTx returns the tag IDs of each of the given media
+func mediaTagSetsTx(tx *sql.Tx, mediaIDs []int64) (map[int64]map[int64]bool, error) {
+	clause, args := inClause("media_id", mediaIDs)
+	rows, err := tx.Query("SELECT media_id, tag_id FROM media_tags WHERE "+clause, args...)
+	if err != nil {
+		return nil, WrapQueryError("media tags", err)
+	}
+	defer rows.Close()
+
+	sets := make(map[int64]map[int64]bool, len(mediaIDs))
+	for rows.Next() {
+		var mediaID, tagID int64
+		if err := rows.Scan(&mediaID, &tagID); err != nil {
+			return nil, WrapScanError("media tag", err)
+		}
+		if sets[mediaID] == nil {
+			sets[mediaID] = make(map[int64]bool)
+		}
+		sets[mediaID][tagID] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("media tag", err)
+	}
+
+	return sets, nil
+}
+
+// recordBulkTagChangeTx records a media_tags row added or removed by a bulk edit
+func recordBulkTagChangeTx(tx *sql.Tx, editID, mediaID, tagID int64, added bool) error {
+	_, err := tx.Exec("INSERT INTO bulk_tag_edit_changes (edit_id, media_id, tag_id, added) VALUES (?, ?, ?, ?)",
+		editID, mediaID, tagID, added)
+	if err != nil {
+		return WrapCreateError("bulk tag edit change", err)
+	}
+	return nil
+}
+
+// recordBulkCategoryChangesTx records the previous category of each tag whose category differs
+// from the one in categories. Only the first change to a tag within an edit is kept, so undo
+// restores the category the tag had before the edit started.
+func recordBulkCategoryChangesTx(tx *sql.Tx, editID int64, categories map[int64]models.TagCategory) error {
+	for tagID, oldCategory := range categories {
+		var category models.TagCategory
+		if err := tx.QueryRow("SELECT category FROM tags WHERE id = ?", tagID).Scan(&category); err != nil {
+			return WrapGetByIDError("tag", err)
+		}
+		if category == oldCategory {
+			continue
+		}
+
+		_, err := tx.Exec("INSERT OR IGNORE INTO bulk_tag_edit_categories (edit_id, tag_id, old_category) VALUES (?, ?, ?)",
+			editID, tagID, oldCategory)
+		if err != nil {
+			return WrapCreateError("bulk tag edit category", err)
+		}
+	}
+	return nil
+}
+
+// GetBulkTagEdits lists the most recent bulk tag edits, newest first
+func (db *DB) GetBulkTagEdits(limit int) ([]*models.BulkTagEdit, error) {
+	query := `
+		SELECT id, description, matched_count, changed_count, created_at, undone_at
+		FROM bulk_tag_edits
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, WrapQueryError("bulk tag edits", err)
+	}
+	defer rows.Close()
+
+	var edits []*models.BulkTagEdit
+	for rows.Next() {
+		edit := &models.BulkTagEdit{}
+		err := rows.Scan(&edit.ID, &edit.Description, &edit.MatchedCount, &edit.ChangedCount, &edit.CreatedAt, &edit.UndoneAt)
+		if err != nil {
+			return nil, WrapScanError("bulk tag edit", err)
+		}
+		edits = append(edits, edit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("bulk tag edit", err)
+	}
+
+	return edits, nil
+}
+
+// UndoBulkTagEdit reverses a bulk tag edit, removing the tags it added, restoring the tags it
+// removed and moving the tags it recategorized back to their old category. Changes to media or
+// tags deleted since are skipped, and tags changed again by hand afterwards are simply set back.
+// An edit can only be undone once.
+func (db *DB) UndoBulkTagEdit(id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	var undoneAt *int64
+	err = tx.QueryRow("SELECT undone_at FROM bulk_tag_edits WHERE id = ?", id).Scan(&undoneAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return WrapGetByIDError("bulk tag edit", err)
+	}
+	if undoneAt != nil {
+		return fmt.Errorf("%w: bulk tag edit %d has already been undone", ErrConstraintViolation, id)
+	}
+
+	now := time.Now().Unix()
+
+	_, err = tx.Exec(`
+		DELETE FROM media_tags
+		WHERE (media_id, tag_id) IN (
+			SELECT media_id, tag_id FROM bulk_tag_edit_changes WHERE edit_id = ? AND added = 1
+		)
+	`, id)
+	if err != nil {
+		return WrapExecError("undo bulk tag edit", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO media_tags (media_id, tag_id, created_at)
+		SELECT media_id, tag_id, ? FROM bulk_tag_edit_changes WHERE edit_id = ? AND added = 0
+	`, now, id)
+	if err != nil {
+		return WrapExecError("undo bulk tag edit", err)
+	}
+
+	if err := restoreBulkCategoriesTx(tx, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE bulk_tag_edits SET undone_at = ? WHERE id = ?", now, id); err != nil {
+		return WrapUpdateError("bulk tag edit", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return WrapTransactionCommitError(err)
+	}
+
+	return nil
+}
+
+// restoreBulkCategoriesTx moves the tags recategorized by a bulk edit back to their old category
+// and recomputes the tag counts of their media
+func restoreBulkCategoriesTx(tx *sql.Tx, editID int64) error {
+	rows, err := tx.Query("SELECT tag_id, old_category FROM bulk_tag_edit_categories WHERE edit_id = ?", editID)
+	if err != nil {
+		return WrapQueryError("bulk tag edit categories", err)
+	}
+	defer rows.Close()
+
+	categories := make(map[int64]models.TagCategory)
+	for rows.Next() {
+		var tagID int64
+		var category models.TagCategory
+		if err := rows.Scan(&tagID, &category); err != nil {
+			return WrapScanError("bulk tag edit category", err)
+		}
+		categories[tagID] = category
+	}
+	if err = rows.Err(); err != nil {
+		return WrapIterationError("bulk tag edit category", err)
+	}
+
+	for tagID, category := range categories {
+		if _, err := tx.Exec("UPDATE tags SET category = ? WHERE id = ?", category, tagID); err != nil {
+			return WrapUpdateError("tag", err)
+		}
+		if err := recountTaggedMediaTx(tx, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
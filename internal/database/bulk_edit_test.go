@@ -0,0 +1,116 @@
+package database
+
+import (
+	"testing"
+
+	"mybooru/internal/models"
+)
+
+func TestBulkEditTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	first := createTestMedia(t, db, "beach", "wip")
+	second := createTestMedia(t, db, "beach", "landscape")
+	third := createTestMedia(t, db, "beach", "wip")
+	other := createTestMedia(t, db, "city", "wip")
+
+	delta := models.TagDelta{
+		Add:    []models.CreateTagInput{{Name: "landscape"}},
+		Remove: []string{"wip"},
+	}
+
+	dryRun, err := db.BulkEditTags(parseQuery(t, "beach"), delta, models.BulkEditOptions{DryRun: true})
+	AssertNoError(t, err, "dry run failed")
+	AssertEqual(t, dryRun.ID, 0, "dry run should not be recorded")
+	AssertEqual(t, dryRun.MatchedCount, 3, "dry run matched count")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "wip")), []int64{other, third, first}, "dry run should not change tags")
+
+	var progress [][2]int
+	edit, err := db.BulkEditTags(parseQuery(t, "beach"), delta, models.BulkEditOptions{
+		BatchSize:   2,
+		Description: "beach: +landscape -wip",
+		Progress:    func(done, total int) { progress = append(progress, [2]int{done, total}) },
+	})
+	AssertNoError(t, err, "BulkEditTags failed")
+	AssertEqual(t, edit.MatchedCount, 3, "matched count")
+	AssertEqual(t, edit.ChangedCount, 2, "media that already matched the delta should not count as changed")
+	AssertEqual(t, progress, [][2]int{{2, 3}, {3, 3}}, "progress should be reported per batch")
+
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "landscape")), []int64{third, second, first}, "tags should be added")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "wip")), []int64{other}, "tags should be removed")
+
+	edits, err := db.GetBulkTagEdits(10)
+	AssertNoError(t, err, "GetBulkTagEdits failed")
+	AssertEqual(t, len(edits), 1, "edit should be recorded")
+	AssertEqual(t, edits[0].Description, "beach: +landscape -wip", "recorded description")
+	AssertEqual(t, edits[0].ChangedCount, 2, "recorded changed count")
+
+	AssertNoError(t, db.UndoBulkTagEdit(edit.ID), "UndoBulkTagEdit failed")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "landscape")), []int64{second}, "undo should remove added tags")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "wip")), []int64{other, third, first}, "undo should restore removed tags")
+
+	for _, id := range []int64{first, third} {
+		media, err := db.GetMediaByID(id)
+		AssertNoError(t, err, "GetMediaByID failed")
+		AssertEqual(t, media.TagCount, 2, "tag count after undo")
+	}
+
+	AssertError(t, db.UndoBulkTagEdit(edit.ID), "an edit should only be undone once")
+	AssertEqual(t, db.UndoBulkTagEdit(999999), ErrNotFound, "missing edit")
+
+	_, err = db.BulkEditTags(parseQuery(t, "beach"), models.TagDelta{}, models.BulkEditOptions{})
+	AssertError(t, err, "an empty delta should be rejected")
+}
+
+func TestBulkEditTagsUndoesRecategorization(t *testing.T) {
+	db := SetupTestDB(t)
+
+	first := createTestMedia(t, db, "someone")
+	createTestMedia(t, db, "beach")
+
+	delta := models.TagDelta{
+		Add: []models.CreateTagInput{{Name: "someone", Category: models.TagCategoryArtist, ExplicitCategory: true}},
+	}
+	edit, err := db.BulkEditTags(parseQuery(t, "beach"), delta, models.BulkEditOptions{})
+	AssertNoError(t, err, "BulkEditTags failed")
+
+	tag, err := db.GetTagByName("someone")
+	AssertNoError(t, err, "GetTagByName failed")
+	AssertEqual(t, tag.Category, models.TagCategoryArtist, "the delta should promote the tag")
+
+	AssertNoError(t, db.UndoBulkTagEdit(edit.ID), "UndoBulkTagEdit failed")
+
+	tag, err = db.GetTagByName("someone")
+	AssertNoError(t, err, "GetTagByName failed")
+	AssertEqual(t, tag.Category, models.TagCategoryGeneral, "undo should restore the old category")
+
+	media, err := db.GetMediaByID(first)
+	AssertNoError(t, err, "GetMediaByID failed")
+	AssertEqual(t, media.TagCountGeneral, 1, "general tag count after undo")
+	AssertEqual(t, media.TagCountArtist, 0, "artist tag count after undo")
+
+	audit, err := db.AuditCounters(false)
+	AssertNoError(t, err, "AuditCounters failed")
+	AssertEqual(t, len(audit.Discrepancies), 0, "counters should be consistent after undo")
+}
+
+func TestBulkEditTagsAllMedia(t *testing.T) {
+	db := SetupTestDB(t)
+
+	createTestMedia(t, db, "beach")
+	createTestMedia(t, db, "city")
+
+	delta := models.TagDelta{Add: []models.CreateTagInput{{Name: "imported"}}}
+
+	dryRun, err := db.BulkEditTags(parseQuery(t, ""), delta, models.BulkEditOptions{DryRun: true})
+	AssertNoError(t, err, "a dry run over everything should be allowed")
+	AssertEqual(t, dryRun.MatchedCount, 2, "dry run matched count")
+
+	_, err = db.BulkEditTags(parseQuery(t, ""), delta, models.BulkEditOptions{})
+	AssertError(t, err, "an empty query should be rejected without AllMedia")
+	AssertEqual(t, len(searchIDs(t, db, parseQuery(t, "imported"))), 0, "a rejected edit should not change tags")
+
+	edit, err := db.BulkEditTags(parseQuery(t, ""), delta, models.BulkEditOptions{AllMedia: true})
+	AssertNoError(t, err, "BulkEditTags with AllMedia failed")
+	AssertEqual(t, edit.ChangedCount, 2, "every media item should be edited")
+}
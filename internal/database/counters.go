@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+
+	"mybooru/internal/models"
+)
+
+// mediaTagCountsSQL recomputes every tag counter of the media rows matched by the WHERE
+// clause appended to it from media_tags, using each tag's current category
+const mediaTagCountsSQL = `
+	UPDATE media SET
+		tag_count = (SELECT COUNT(*) FROM media_tags mt WHERE mt.media_id = media.id),
+		tag_count_general = (SELECT COUNT(*) FROM media_tags mt JOIN tags t ON t.id = mt.tag_id
+			WHERE mt.media_id = media.id AND t.category = 0),
+		tag_count_artist = (SELECT COUNT(*) FROM media_tags mt JOIN tags t ON t.id = mt.tag_id
+			WHERE mt.media_id = media.id AND t.category = 1),
+		tag_count_copyright = (SELECT COUNT(*) FROM media_tags mt JOIN tags t ON t.id = mt.tag_id
+			WHERE mt.media_id = media.id AND t.category = 2),
+		tag_count_character = (SELECT COUNT(*) FROM media_tags mt JOIN tags t ON t.id = mt.tag_id
+			WHERE mt.media_id = media.id AND t.category = 3),
+		tag_count_metadata = (SELECT COUNT(*) FROM media_tags mt JOIN tags t ON t.id = mt.tag_id
+			WHERE mt.media_id = media.id AND t.category = 4)
+`
+
+// mediaCountersSQL reads the stored counters of every media item next to their true values
+const mediaCountersSQL = `
+	SELECT m.id,
+	       m.tag_count, COALESCE(c.total, 0),
+	       m.tag_count_general, COALESCE(c.general, 0),
+	       m.tag_count_artist, COALESCE(c.artist, 0),
+	       m.tag_count_copyright, COALESCE(c.copyright, 0),
+	       m.tag_count_character, COALESCE(c.character, 0),
+	       m.tag_count_metadata, COALESCE(c.metadata, 0),
+	       m.has_children, EXISTS (SELECT 1 FROM media child WHERE child.parent_id = m.id)
+	FROM media m
+	LEFT JOIN (
+		SELECT mt.media_id,
+		       COUNT(*) AS total,
+		       SUM(t.category = 0) AS general,
+		       SUM(t.category = 1) AS artist,
+		       SUM(t.category = 2) AS copyright,
+		       SUM(t.category = 3) AS character,
+		       SUM(t.category = 4) AS metadata
+		FROM media_tags mt
+		JOIN tags t ON t.id = mt.tag_id
+		GROUP BY mt.media_id
+	) c ON c.media_id = m.id
+	ORDER BY m.id
+`
+
+// mediaCounterColumns names the column pairs read by mediaCountersSQL, in order
+var mediaCounterColumns = []string{
+	"tag_count",
+	"tag_count_general",
+	"tag_count_artist",
+	"tag_count_copyright",
+	"tag_count_character",
+	"tag_count_metadata",
+	"has_children",
+}
+
+// AuditCounters checks the counters maintained by triggers against media_tags and media and
+// reports the ones that are out of step: the tag counts and has_children flag of each media item,
+// and the usage count of each tag. If fix is set, the discrepancies are repaired in the same transaction.
+func (db *DB) AuditCounters(fix bool) (*models.CounterAudit, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	audit := &models.CounterAudit{Discrepancies: []models.CounterDiscrepancy{}}
+
+	mediaDiscrepancies, err := auditMediaCountersTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	tagDiscrepancies, err := auditTagCountersTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	audit.Discrepancies = append(audit.Discrepancies, mediaDiscrepancies...)
+	audit.Discrepancies = append(audit.Discrepancies, tagDiscrepancies...)
+
+	if !fix || len(audit.Discrepancies) == 0 {
+		return audit, nil
+	}
+
+	recounted := make(map[int64]bool)
+	for _, d := range mediaDiscrepancies {
+		if d.Column == "has_children" || recounted[d.ID] {
+			continue
+		}
+		recounted[d.ID] = true
+		if _, err := tx.Exec(mediaTagCountsSQL+`WHERE id = ?`, d.ID); err != nil {
+			return nil, WrapExecError("recount media tags", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE media SET has_children = EXISTS (SELECT 1 FROM media child WHERE child.parent_id = media.id)
+		WHERE has_children != EXISTS (SELECT 1 FROM media child WHERE child.parent_id = media.id)
+	`)
+	if err != nil {
+		return nil, WrapExecError("repair has_children", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tags SET usage_count = (SELECT COUNT(*) FROM media_tags WHERE tag_id = tags.id)
+		WHERE usage_count != (SELECT COUNT(*) FROM media_tags WHERE tag_id = tags.id)
+	`)
+	if err != nil {
+		return nil, WrapExecError("recount tag usage", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, WrapTransactionCommitError(err)
+	}
+
+	audit.Fixed = true
+	return audit, nil
+}
+
+// auditMediaCountersTx lists the media counters that don't match media_tags and media
+func auditMediaCountersTx(tx *sql.Tx) ([]models.CounterDiscrepancy, error) {
+	rows, err := tx.Query(mediaCountersSQL)
+	if err != nil {
+		return nil, WrapQueryError("media counters", err)
+	}
+	defer rows.Close()
+
+	var discrepancies []models.CounterDiscrepancy
+	values := make([]int64, 2*len(mediaCounterColumns))
+	dest := make([]any, 1+len(values))
+	for rows.Next() {
+		var id int64
+		dest[0] = &id
+		for i := range values {
+			dest[i+1] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, WrapScanError("media counters", err)
+		}
+
+		for i, column := range mediaCounterColumns {
+			stored, actual := values[2*i], values[2*i+1]
+			if stored != actual {
+				discrepancies = append(discrepancies, models.CounterDiscrepancy{
+					Table: "media", ID: id, Column: column, Stored: stored, Actual: actual,
+				})
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("media counters", err)
+	}
+
+	return discrepancies, nil
+}
+
+// auditTagCountersTx lists the tag usage counts that don't match media_tags
+func auditTagCountersTx(tx *sql.Tx) ([]models.CounterDiscrepancy, error) {
+	rows, err := tx.Query(`
+		SELECT t.id, t.usage_count, COUNT(mt.tag_id)
+		FROM tags t
+		LEFT JOIN media_tags mt ON mt.tag_id = t.id
+		GROUP BY t.id
+		HAVING t.usage_count != COUNT(mt.tag_id)
+		ORDER BY t.id
+	`)
+	if err != nil {
+		return nil, WrapQueryError("tag counters", err)
+	}
+	defer rows.Close()
+
+	var discrepancies []models.CounterDiscrepancy
+	for rows.Next() {
+		d := models.CounterDiscrepancy{Table: "tags", Column: "usage_count"}
+		if err := rows.Scan(&d.ID, &d.Stored, &d.Actual); err != nil {
+			return nil, WrapScanError("tag counters", err)
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("tag counters", err)
+	}
+
+	return discrepancies, nil
+}
+
+// recountTaggedMediaTx recomputes the tag counters of every media item tagged with tagID
+func recountTaggedMediaTx(tx *sql.Tx, tagID int64) error {
+	_, err := tx.Exec(mediaTagCountsSQL+`WHERE id IN (SELECT media_id FROM media_tags WHERE tag_id = ?)`, tagID)
+	if err != nil {
+		return WrapExecError("recount media tags", err)
+	}
+	return nil
+}
+
+// recountTagUsageTx recomputes the usage count of a single tag
+func recountTagUsageTx(tx *sql.Tx, tagID int64) error {
+	_, err := tx.Exec(`UPDATE tags SET usage_count = (SELECT COUNT(*) FROM media_tags WHERE tag_id = tags.id) WHERE id = ?`, tagID)
+	if err != nil {
+		return WrapExecError("recount tag usage", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"testing"
+
+	"mybooru/internal/models"
+)
+
+func TestAuditCounters(t *testing.T) {
+	db := SetupTestDB(t)
+
+	parent := createTestMedia(t, db, "cat")
+	child := createTestMedia(t, db, "cat", "dog")
+
+	audit, err := db.AuditCounters(false)
+	AssertNoError(t, err, "AuditCounters failed")
+	AssertEqual(t, len(audit.Discrepancies), 0, "fresh library should have no discrepancies")
+
+	cat, err := db.GetTagByName("cat")
+	AssertNoError(t, err, "GetTagByName failed")
+
+	// Unlinking the last child leaves has_children set, and the other counters are broken by hand
+	_, err = db.Exec("UPDATE media SET parent_id = ? WHERE id = ?", parent, child)
+	AssertNoError(t, err, "failed to set parent")
+	_, err = db.Exec("UPDATE media SET parent_id = NULL WHERE id = ?", child)
+	AssertNoError(t, err, "failed to clear parent")
+	_, err = db.Exec("UPDATE media SET tag_count = 5, tag_count_artist = 1 WHERE id = ?", child)
+	AssertNoError(t, err, "failed to break tag counts")
+	_, err = db.Exec("UPDATE tags SET usage_count = 7 WHERE id = ?", cat.ID)
+	AssertNoError(t, err, "failed to break usage count")
+
+	want := []models.CounterDiscrepancy{
+		{Table: "media", ID: parent, Column: "has_children", Stored: 1, Actual: 0},
+		{Table: "media", ID: child, Column: "tag_count", Stored: 5, Actual: 2},
+		{Table: "media", ID: child, Column: "tag_count_artist", Stored: 1, Actual: 0},
+		{Table: "tags", ID: cat.ID, Column: "usage_count", Stored: 7, Actual: 2},
+	}
+
+	audit, err = db.AuditCounters(false)
+	AssertNoError(t, err, "AuditCounters failed")
+	AssertEqual(t, audit.Discrepancies, want, "discrepancies")
+	AssertEqual(t, audit.Fixed, false, "audit without fix should not repair")
+
+	audit, err = db.AuditCounters(true)
+	AssertNoError(t, err, "AuditCounters failed")
+	AssertEqual(t, audit.Discrepancies, want, "discrepancies reported by the fix")
+	AssertEqual(t, audit.Fixed, true, "fix should be reported")
+
+	audit, err = db.AuditCounters(false)
+	AssertNoError(t, err, "AuditCounters failed")
+	AssertEqual(t, len(audit.Discrepancies), 0, "fix should repair every discrepancy")
+
+	media, err := db.GetMediaByID(child)
+	AssertNoError(t, err, "GetMediaByID failed")
+	AssertEqual(t, media.TagCount, 2, "repaired tag count")
+}
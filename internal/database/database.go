@@ -1,23 +1,111 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // DB wraps the SQLite database connection
 type DB struct {
 	*sql.DB
+	tags *tagIndex
 }
 
-// InitDB initializes the database connection and creates tables
-func InitDB(path string) (*DB, error) {
-	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+// hookConnector opens SQLite connections with hooks that report tag changes to a tag index
+type hookConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+	index  *tagIndex
+}
+
+func (c hookConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	sqliteConn := conn.(*sqlite3.SQLiteConn)
+	hooks := c.index.connectionHooks()
+	sqliteConn.RegisterUpdateHook(hooks.update)
+	sqliteConn.RegisterCommitHook(hooks.commit)
+	sqliteConn.RegisterRollbackHook(hooks.rollback)
+
+	return &hookConn{SQLiteConn: sqliteConn, hooks: hooks}, nil
+}
+
+func (c hookConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// hookConn publishes the tag changes committed on a connection once each commit has returned.
+// SQLite has no hook that runs after a commit, so this wraps everything that can commit:
+// autocommit statements and transaction commits.
+type hookConn struct {
+	*sqlite3.SQLiteConn
+	hooks *connectionHooks
+}
+
+func (c *hookConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	c.hooks.publish()
+	return result, err
+}
+
+func (c *hookConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &hookStmt{SQLiteStmt: stmt.(*sqlite3.SQLiteStmt), hooks: c.hooks}, nil
+}
+
+func (c *hookConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.SQLiteConn.BeginTx(ctx, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
+	return &hookTx{Tx: tx, hooks: c.hooks}, nil
+}
+
+// hookStmt publishes tag changes after a prepared statement commits in autocommit mode
+type hookStmt struct {
+	*sqlite3.SQLiteStmt
+	hooks *connectionHooks
+}
+
+func (s *hookStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	result, err := s.SQLiteStmt.ExecContext(ctx, args)
+	s.hooks.publish()
+	return result, err
+}
+
+// hookTx publishes tag changes after a transaction commits
+type hookTx struct {
+	driver.Tx
+	hooks *connectionHooks
+}
+
+func (tx *hookTx) Commit() error {
+	err := tx.Tx.Commit()
+	tx.hooks.publish()
+	return err
+}
+
+// openDB opens a database whose connections report tag changes to a fresh tag index
+func openDB(dsn string) *DB {
+	index := newTagIndex()
+	connector := hookConnector{dsn: dsn, driver: &sqlite3.SQLiteDriver{}, index: index}
+	return &DB{DB: sql.OpenDB(connector), tags: index}
+}
+
+// InitDB initializes the database connection and creates tables
+func InitDB(path string) (*DB, error) {
+	database := openDB(path + "?_foreign_keys=on")
+	db := database.DB
 
 	if err := configurePragmas(db); err != nil {
 		db.Close()
@@ -29,7 +117,7 @@ func InitDB(path string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	return database, nil
 }
 
 // configurePragmas sets up SQLite pragmas for optimal performance
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"strings"
+
+	"mybooru/internal/models"
+)
+
+// searchFacets lists the media columns that searches are broken down by.
+// Every expression yields the value as written in the matching query filter.
+var searchFacets = []struct {
+	name   string
+	column string
+	target func(*models.SearchFacets) *[]models.FacetValue
+}{
+	{name: "rating", column: "m.rating", target: func(f *models.SearchFacets) *[]models.FacetValue { return &f.Rating }},
+	{name: "media type", column: "m.media_type", target: func(f *models.SearchFacets) *[]models.FacetValue { return &f.MediaType }},
+	{name: "favorite", column: "CASE m.is_favorite WHEN 1 THEN 'true' ELSE 'false' END", target: func(f *models.SearchFacets) *[]models.FacetValue { return &f.Favorite }},
+	{name: "extension", column: "LOWER(m.file_ext)", target: func(f *models.SearchFacets) *[]models.FacetValue { return &f.Extension }},
+}
+
+// GetSearchFacets counts the media matching a search by rating, media type, favorite and file
+// extension. Only values that occur are listed. The Query of each value is left for the caller to fill in.
+func (db *DB) GetSearchFacets(query *models.SearchQuery) (*models.SearchFacets, error) {
+	clauses, args, err := buildSearchConditions(query)
+	if err != nil {
+		return nil, err
+	}
+
+	whereClause := ""
+	if len(clauses) > 0 {
+		whereClause = " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	facets := &models.SearchFacets{}
+	for _, facet := range searchFacets {
+		values, err := db.facetCounts(facet.name, facet.column, whereClause, args)
+		if err != nil {
+			return nil, err
+		}
+		*facet.target(facets) = values
+	}
+
+	return facets, nil
+}
+
+// facetCounts groups the media selected by whereClause on a single column
+func (db *DB) facetCounts(name, column, whereClause string, args []interface{}) ([]models.FacetValue, error) {
+	query := "SELECT " + column + " AS value, COUNT(*) AS count FROM media m" + whereClause +
+		" GROUP BY value ORDER BY count DESC, value"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, WrapQueryError(name+" facet", err)
+	}
+	defer rows.Close()
+
+	values := []models.FacetValue{}
+	for rows.Next() {
+		var v models.FacetValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, WrapScanError(name+" facet", err)
+		}
+		values = append(values, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError(name+" facet", err)
+	}
+
+	return values, nil
+}
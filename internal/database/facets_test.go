@@ -0,0 +1,56 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"mybooru/internal/models"
+)
+
+func TestGetSearchFacets(t *testing.T) {
+	db := SetupTestDB(t)
+
+	media := []struct {
+		ext       string
+		mediaType models.MediaType
+		rating    models.Rating
+	}{
+		{"png", models.MediaTypeImage, models.RatingSafe},
+		{"PNG", models.MediaTypeImage, models.RatingQuestionable},
+		{"jpg", models.MediaTypeImage, models.RatingSafe},
+		{"webm", models.MediaTypeVideo, models.RatingExplicit},
+	}
+	var ids []int64
+	for _, m := range media {
+		testMediaSeq++
+		id, err := db.CreateMedia(&models.CreateMediaInput{
+			MD5:       fmt.Sprintf("%032x", testMediaSeq),
+			FileExt:   m.ext,
+			MediaType: m.mediaType,
+			MimeType:  string(m.mediaType) + "/" + m.ext,
+			FileSize:  1024,
+			Rating:    m.rating,
+		})
+		AssertNoError(t, err, "CreateMedia failed")
+		ids = append(ids, id)
+	}
+	_, err := db.ToggleFavorite(ids[0])
+	AssertNoError(t, err, "ToggleFavorite failed")
+	createTestMedia(t, db, "cat")
+
+	facets, err := db.GetSearchFacets(parseQuery(t, ""))
+	AssertNoError(t, err, "GetSearchFacets failed")
+	AssertEqual(t, facets.Rating, []models.FacetValue{{Value: "safe", Count: 3}, {Value: "explicit", Count: 1}, {Value: "questionable", Count: 1}}, "rating facet")
+	AssertEqual(t, facets.MediaType, []models.FacetValue{{Value: "image", Count: 4}, {Value: "video", Count: 1}}, "media type facet")
+	AssertEqual(t, facets.Favorite, []models.FacetValue{{Value: "false", Count: 4}, {Value: "true", Count: 1}}, "favorite facet")
+	AssertEqual(t, facets.Extension, []models.FacetValue{{Value: "png", Count: 3}, {Value: "jpg", Count: 1}, {Value: "webm", Count: 1}}, "extension facet")
+
+	facets, err = db.GetSearchFacets(parseQuery(t, "/type:image -cat"))
+	AssertNoError(t, err, "GetSearchFacets failed")
+	AssertEqual(t, facets.Rating, []models.FacetValue{{Value: "safe", Count: 2}, {Value: "questionable", Count: 1}}, "rating facet should follow the search")
+	AssertEqual(t, facets.Extension, []models.FacetValue{{Value: "png", Count: 2}, {Value: "jpg", Count: 1}}, "extension facet should follow the search")
+
+	facets, err = db.GetSearchFacets(parseQuery(t, "dog"))
+	AssertNoError(t, err, "GetSearchFacets failed")
+	AssertEqual(t, len(facets.Rating)+len(facets.MediaType)+len(facets.Favorite)+len(facets.Extension), 0, "no matches should give empty facets")
+}
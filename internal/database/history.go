@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"mybooru/internal/models"
+)
+
+// RecordSearch adds a query to the search history. Repeating the most recent query updates
+// that entry instead of adding another, so paging through results or re-running a search
+// doesn't flood the history.
+func (db *DB) RecordSearch(query string, resultCount int) error {
+	now := time.Now().Unix()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	var lastID int64
+	var lastQuery string
+	err = tx.QueryRow("SELECT id, query FROM search_history ORDER BY searched_at DESC, id DESC LIMIT 1").Scan(&lastID, &lastQuery)
+	if err != nil && err != sql.ErrNoRows {
+		return WrapQueryError("search history", err)
+	}
+
+	if err == nil && lastQuery == query {
+		_, err = tx.Exec("UPDATE search_history SET result_count = ?, searched_at = ? WHERE id = ?", resultCount, now, lastID)
+		if err != nil {
+			return WrapUpdateError("search history", err)
+		}
+	} else {
+		_, err = tx.Exec("INSERT INTO search_history (query, result_count, searched_at) VALUES (?, ?, ?)", query, resultCount, now)
+		if err != nil {
+			return WrapCreateError("search history", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return WrapTransactionCommitError(err)
+	}
+
+	return nil
+}
+
+// GetRecentSearches retrieves the most recent search history entries, newest first
+func (db *DB) GetRecentSearches(limit int) ([]*models.SearchHistory, error) {
+	query := `
+		SELECT id, query, result_count, searched_at
+		FROM search_history
+		ORDER BY searched_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, WrapQueryError("search history", err)
+	}
+	defer rows.Close()
+
+	var history []*models.SearchHistory
+	for rows.Next() {
+		entry := &models.SearchHistory{}
+		if err := rows.Scan(&entry.ID, &entry.Query, &entry.ResultCount, &entry.SearchedAt); err != nil {
+			return nil, WrapScanError("search history", err)
+		}
+		history = append(history, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("search history", err)
+	}
+
+	return history, nil
+}
+
+// GetFrequentSearches retrieves the most often run queries, most frequent first
+func (db *DB) GetFrequentSearches(limit int) ([]*models.SearchFrequency, error) {
+	query := `
+		SELECT query, COUNT(*) AS times, MAX(searched_at) AS last_searched
+		FROM search_history
+		GROUP BY query
+		ORDER BY times DESC, last_searched DESC, MAX(id) DESC
+		LIMIT ?
+	`
+
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, WrapQueryError("search history", err)
+	}
+	defer rows.Close()
+
+	var searches []*models.SearchFrequency
+	for rows.Next() {
+		entry := &models.SearchFrequency{}
+		if err := rows.Scan(&entry.Query, &entry.Count, &entry.LastSearchedAt); err != nil {
+			return nil, WrapScanError("search history", err)
+		}
+		searches = append(searches, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("search history", err)
+	}
+
+	return searches, nil
+}
+
+// DeleteSearchHistory deletes a single search history entry by ID
+func (db *DB) DeleteSearchHistory(id int64) error {
+	result, err := db.Exec("DELETE FROM search_history WHERE id = ?", id)
+	if err != nil {
+		return WrapDeleteError("search history", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return WrapRowsAffectedError(err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ClearSearchHistory deletes every search history entry
+func (db *DB) ClearSearchHistory() error {
+	if _, err := db.Exec("DELETE FROM search_history"); err != nil {
+		return WrapDeleteError("search history", err)
+	}
+	return nil
+}
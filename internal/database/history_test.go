@@ -0,0 +1,62 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func historyQueries(t *testing.T, db *DB) []string {
+	t.Helper()
+
+	history, err := db.GetRecentSearches(10)
+	AssertNoError(t, err, "GetRecentSearches failed")
+
+	queries := make([]string, 0, len(history))
+	for _, entry := range history {
+		queries = append(queries, entry.Query)
+	}
+	return queries
+}
+
+func TestRecordSearch(t *testing.T) {
+	db := SetupTestDB(t)
+
+	for _, q := range []string{"cat", "cat", "dog", "cat", "cat"} {
+		AssertNoError(t, db.RecordSearch(q, len(q)), "RecordSearch failed")
+	}
+	AssertEqual(t, historyQueries(t, db), []string{"cat", "dog", "cat"}, "consecutive duplicates should be collapsed")
+
+	AssertNoError(t, db.RecordSearch("dog", 42), "RecordSearch failed")
+	history, err := db.GetRecentSearches(1)
+	AssertNoError(t, err, "GetRecentSearches failed")
+	AssertEqual(t, len(history), 1, "limit should be respected")
+	AssertEqual(t, history[0].Query, "dog", "most recent query")
+	AssertEqual(t, history[0].ResultCount, 42, "result count")
+
+	frequent, err := db.GetFrequentSearches(10)
+	AssertNoError(t, err, "GetFrequentSearches failed")
+	AssertEqual(t, len(frequent), 2, "frequent search count")
+	AssertEqual(t, frequent[0].Query, "dog", "ties should favour the most recent query")
+	AssertEqual(t, frequent[0].Count, 2, "dog count")
+	AssertEqual(t, frequent[1].Count, 2, "cat count")
+}
+
+func TestDeleteSearchHistory(t *testing.T) {
+	db := SetupTestDB(t)
+
+	for _, q := range []string{"cat", "dog", "bird"} {
+		AssertNoError(t, db.RecordSearch(q, 1), "RecordSearch failed")
+	}
+
+	history, err := db.GetRecentSearches(10)
+	AssertNoError(t, err, "GetRecentSearches failed")
+	AssertNoError(t, db.DeleteSearchHistory(history[1].ID), "DeleteSearchHistory failed")
+	AssertEqual(t, historyQueries(t, db), []string{"bird", "cat"}, "entry should be deleted")
+
+	if !errors.Is(db.DeleteSearchHistory(history[1].ID), ErrNotFound) {
+		t.Error("deleting a missing entry should return ErrNotFound")
+	}
+
+	AssertNoError(t, db.ClearSearchHistory(), "ClearSearchHistory failed")
+	AssertEqual(t, len(historyQueries(t, db)), 0, "history should be empty after clearing")
+}
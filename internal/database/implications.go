@@ -0,0 +1,290 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"mybooru/internal/models"
+)
+
+// impliedTagsCTE computes the transitive closure of the tags implied by the tag ID bound to it.
+// UNION discards rows already seen, so the recursion terminates even if a cycle slipped in.
+const impliedTagsCTE = `
+	WITH RECURSIVE implied(id) AS (
+		SELECT parent_tag_id FROM tag_implications WHERE child_tag_id = ?
+		UNION
+		SELECT ti.parent_tag_id FROM tag_implications ti JOIN implied ON ti.child_tag_id = implied.id
+	)
+`
+
+// GetTagImplications retrieves all tag implications
+func (db *DB) GetTagImplications() ([]*models.TagImplication, error) {
+	query := `SELECT id, child_tag_id, parent_tag_id, created_at FROM tag_implications ORDER BY id`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, WrapQueryError("tag implications", err)
+	}
+	defer rows.Close()
+
+	var implications []*models.TagImplication
+	for rows.Next() {
+		imp := &models.TagImplication{}
+		if err := rows.Scan(&imp.ID, &imp.ChildTagID, &imp.ParentTagID, &imp.CreatedAt); err != nil {
+			return nil, WrapScanError("tag implication", err)
+		}
+		implications = append(implications, imp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("tag implication", err)
+	}
+
+	return implications, nil
+}
+
+// GetTagImplicationByID retrieves a single tag implication by ID
+func (db *DB) GetTagImplicationByID(id int64) (*models.TagImplication, error) {
+	query := `SELECT id, child_tag_id, parent_tag_id, created_at FROM tag_implications WHERE id = ?`
+
+	imp := &models.TagImplication{}
+	err := db.QueryRow(query, id).Scan(&imp.ID, &imp.ChildTagID, &imp.ParentTagID, &imp.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, WrapGetByIDError("tag implication", err)
+	}
+
+	return imp, nil
+}
+
+// GetImpliedTags retrieves every tag implied by a tag, directly or transitively
+func (db *DB) GetImpliedTags(tagID int64) ([]*models.Tag, error) {
+	query := impliedTagsCTE + `
+		SELECT t.id, t.name, t.category, t.usage_count, t.created_at
+		FROM tags t
+		JOIN implied ON t.id = implied.id
+		WHERE t.id != ?
+		ORDER BY t.category, t.name
+	`
+
+	rows, err := db.Query(query, tagID, tagID)
+	if err != nil {
+		return nil, WrapQueryError("implied tags", err)
+	}
+	defer rows.Close()
+
+	var tags []*models.Tag
+	for rows.Next() {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Category, &tag.UsageCount, &tag.CreatedAt); err != nil {
+			return nil, WrapScanError("tag", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("tag", err)
+	}
+
+	return tags, nil
+}
+
+// CreateTagImplication makes the child tag imply the parent tag, so that media tagged with the
+// child are also tagged with the parent and everything the parent implies.
+// Implications that would form a cycle are rejected.
+// Existing media are not retagged; use ApplyTagImplication for that.
+func (db *DB) CreateTagImplication(childTagID, parentTagID int64) (int64, error) {
+	if childTagID == parentTagID {
+		return 0, fmt.Errorf("%w: a tag cannot imply itself", ErrInvalidInput)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	id, err := createTagImplicationTx(tx, childTagID, parentTagID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, WrapTransactionCommitError(err)
+	}
+
+	return id, nil
+}
+
+// CreateTagImplicationByName is CreateTagImplication for tags given by name. Aliased names are
+// replaced by their consequents, and missing tags are created with the given categories in the
+// same transaction, so a rejected implication leaves no new tags behind.
+func (db *DB) CreateTagImplicationByName(child, parent models.CreateTagInput) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	var childName, parentName string
+	if err := tx.QueryRow("SELECT "+aliasLookupSQL, child.Name, child.Name).Scan(&childName); err != nil {
+		return 0, WrapQueryError("tag aliases", err)
+	}
+	if err := tx.QueryRow("SELECT "+aliasLookupSQL, parent.Name, parent.Name).Scan(&parentName); err != nil {
+		return 0, WrapQueryError("tag aliases", err)
+	}
+	if strings.EqualFold(childName, parentName) {
+		return 0, fmt.Errorf("%w: %s and %s are the same tag", ErrInvalidInput, child.Name, parent.Name)
+	}
+
+	childTagID, err := getOrCreateTagIDTx(tx, childName, child.Category)
+	if err != nil {
+		return 0, err
+	}
+	parentTagID, err := getOrCreateTagIDTx(tx, parentName, parent.Category)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := createTagImplicationTx(tx, childTagID, parentTagID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, WrapTransactionCommitError(err)
+	}
+
+	return id, nil
+}
+
+// createTagImplicationTx inserts an implication between two distinct tags after checking for cycles
+func createTagImplicationTx(tx *sql.Tx, childTagID, parentTagID int64) (int64, error) {
+	// Adding child -> parent closes a cycle if the parent already implies the child
+	var cycle bool
+	err := tx.QueryRow(impliedTagsCTE+`SELECT EXISTS (SELECT 1 FROM implied WHERE id = ?)`, parentTagID, childTagID).Scan(&cycle)
+	if err != nil {
+		return 0, WrapQueryError("implied tags", err)
+	}
+	if cycle {
+		return 0, fmt.Errorf("%w: tag %d already implies tag %d, which would create a cycle", ErrConstraintViolation, parentTagID, childTagID)
+	}
+
+	result, err := tx.Exec("INSERT INTO tag_implications (child_tag_id, parent_tag_id, created_at) VALUES (?, ?, ?)",
+		childTagID, parentTagID, time.Now().Unix())
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return 0, fmt.Errorf("%w: tag %d already implies tag %d", ErrConstraintViolation, childTagID, parentTagID)
+		}
+		if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
+			return 0, ErrNotFound
+		}
+		return 0, WrapCreateError("tag implication", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, WrapLastInsertIDError(err)
+	}
+
+	return id, nil
+}
+
+// DeleteTagImplication deletes a tag implication by ID. Tags it already added to media are kept.
+func (db *DB) DeleteTagImplication(id int64) error {
+	result, err := db.Exec("DELETE FROM tag_implications WHERE id = ?", id)
+	if err != nil {
+		return WrapDeleteError("tag implication", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return WrapRowsAffectedError(err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ApplyTagImplication retags every existing media item that has the implication's child tag
+// with the parent tag and everything the parent implies. It returns the number of tags added.
+func (db *DB) ApplyTagImplication(id int64) (int64, error) {
+	imp, err := db.GetTagImplicationByID(id)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(impliedTagsCTE+`
+		INSERT OR IGNORE INTO media_tags (media_id, tag_id, created_at)
+		SELECT mt.media_id, implied.id, ?
+		FROM media_tags mt, implied
+		WHERE mt.tag_id = ?
+	`, imp.ChildTagID, time.Now().Unix(), imp.ChildTagID)
+	if err != nil {
+		return 0, WrapExecError("apply tag implication", err)
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		return 0, WrapRowsAffectedError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, WrapTransactionCommitError(err)
+	}
+
+	return added, nil
+}
+
+// addImpliedTagsTx tags a media item with every tag implied by tagID
+func addImpliedTagsTx(tx *sql.Tx, mediaID, tagID int64, now int64) error {
+	_, err := tx.Exec(impliedTagsCTE+`
+		INSERT OR IGNORE INTO media_tags (media_id, tag_id, created_at)
+		SELECT ?, id, ? FROM implied
+	`, tagID, mediaID, now)
+	if err != nil {
+		return fmt.Errorf("failed to add implied tags to media: %w", err)
+	}
+	return nil
+}
+
+// moveTagImplicationsTx moves the implications of fromID, in either direction, onto toID.
+// Implications toID already has are dropped along with any that would make it imply itself,
+// and the move is rejected if it would close a cycle through toID.
+func moveTagImplicationsTx(tx *sql.Tx, fromID, toID int64) error {
+	if _, err := tx.Exec("UPDATE OR IGNORE tag_implications SET child_tag_id = ? WHERE child_tag_id = ?", toID, fromID); err != nil {
+		return WrapUpdateError("tag implications", err)
+	}
+	if _, err := tx.Exec("UPDATE OR IGNORE tag_implications SET parent_tag_id = ? WHERE parent_tag_id = ?", toID, fromID); err != nil {
+		return WrapUpdateError("tag implications", err)
+	}
+	_, err := tx.Exec("DELETE FROM tag_implications WHERE child_tag_id = parent_tag_id OR ? IN (child_tag_id, parent_tag_id)", fromID)
+	if err != nil {
+		return WrapDeleteError("tag implications", err)
+	}
+
+	var cycle bool
+	err = tx.QueryRow(impliedTagsCTE+`SELECT EXISTS (SELECT 1 FROM implied WHERE id = ?)`, toID, toID).Scan(&cycle)
+	if err != nil {
+		return WrapQueryError("implied tags", err)
+	}
+	if cycle {
+		return fmt.Errorf("%w: merging tag %d into tag %d would create an implication cycle", ErrConstraintViolation, fromID, toID)
+	}
+
+	return nil
+}
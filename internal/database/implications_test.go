@@ -0,0 +1,176 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"mybooru/internal/models"
+)
+
+// createTestTag creates a tag and returns its ID
+func createTestTag(t *testing.T, db *DB, name string, category models.TagCategory) int64 {
+	t.Helper()
+
+	id, err := db.CreateTag(&models.CreateTagInput{Name: name, Category: category})
+	AssertNoError(t, err, "CreateTag failed")
+	return id
+}
+
+func TestCreateTagImplication(t *testing.T) {
+	db := SetupTestDB(t)
+
+	miku := createTestTag(t, db, "hatsune_miku", models.TagCategoryCharacter)
+	vocaloid := createTestTag(t, db, "vocaloid", models.TagCategoryCopyright)
+	music := createTestTag(t, db, "music", models.TagCategoryGeneral)
+
+	_, err := db.CreateTagImplication(miku, vocaloid)
+	AssertNoError(t, err, "CreateTagImplication failed")
+	_, err = db.CreateTagImplication(vocaloid, music)
+	AssertNoError(t, err, "CreateTagImplication failed")
+
+	tests := []struct {
+		name    string
+		child   int64
+		parent  int64
+		wantErr error
+	}{
+		{name: "self implication", child: miku, parent: miku, wantErr: ErrInvalidInput},
+		{name: "duplicate", child: miku, parent: vocaloid, wantErr: ErrConstraintViolation},
+		{name: "direct cycle", child: vocaloid, parent: miku, wantErr: ErrConstraintViolation},
+		{name: "transitive cycle", child: music, parent: miku, wantErr: ErrConstraintViolation},
+		{name: "missing tag", child: miku, parent: 9999, wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.CreateTagImplication(tt.child, tt.parent)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	implied, err := db.GetImpliedTags(miku)
+	AssertNoError(t, err, "GetImpliedTags failed")
+	AssertEqual(t, tagNames(implied), []string{"music", "vocaloid"}, "implied tags should include transitive parents")
+
+	implications, err := db.GetTagImplications()
+	AssertNoError(t, err, "GetTagImplications failed")
+	AssertEqual(t, len(implications), 2, "implication count mismatch")
+
+	AssertNoError(t, db.DeleteTagImplication(implications[1].ID), "DeleteTagImplication failed")
+	implied, err = db.GetImpliedTags(miku)
+	AssertNoError(t, err, "GetImpliedTags failed")
+	AssertEqual(t, tagNames(implied), []string{"vocaloid"}, "deleted implication should no longer apply")
+
+	if !errors.Is(db.DeleteTagImplication(implications[1].ID), ErrNotFound) {
+		t.Error("deleting a missing implication should return ErrNotFound")
+	}
+}
+
+func TestCreateTagImplicationByName(t *testing.T) {
+	db := SetupTestDB(t)
+
+	miku := createTestTag(t, db, "hatsune_miku", models.TagCategoryCharacter)
+	vocaloid := createTestTag(t, db, "vocaloid", models.TagCategoryCopyright)
+	_, err := db.CreateTagImplication(miku, vocaloid)
+	AssertNoError(t, err, "CreateTagImplication failed")
+	_, err = db.CreateTagAlias("miku", "hatsune_miku", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	_, err = db.CreateTagImplicationByName(
+		models.CreateTagInput{Name: "miku"},
+		models.CreateTagInput{Name: "singer", Category: models.TagCategoryGeneral},
+	)
+	AssertNoError(t, err, "CreateTagImplicationByName failed")
+	implied, err := db.GetImpliedTags(miku)
+	AssertNoError(t, err, "GetImpliedTags failed")
+	AssertEqual(t, tagNames(implied), []string{"singer", "vocaloid"}, "aliased child should resolve to its consequent")
+
+	var before int
+	AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM tags").Scan(&before), "counting tags failed")
+
+	tests := []struct {
+		name    string
+		child   string
+		parent  string
+		wantErr error
+	}{
+		{name: "self implication", child: "new_tag", parent: "NEW_TAG", wantErr: ErrInvalidInput},
+		{name: "self implication through alias", child: "miku", parent: "hatsune_miku", wantErr: ErrInvalidInput},
+		{name: "duplicate", child: "hatsune_miku", parent: "vocaloid", wantErr: ErrConstraintViolation},
+		{name: "cycle", child: "vocaloid", parent: "miku", wantErr: ErrConstraintViolation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.CreateTagImplicationByName(models.CreateTagInput{Name: tt.child}, models.CreateTagInput{Name: tt.parent})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	_, err = db.CreateTagImplicationByName(models.CreateTagInput{Name: "new_child"}, models.CreateTagInput{Name: "hatsune_miku"})
+	AssertNoError(t, err, "CreateTagImplicationByName failed")
+	_, err = db.CreateTagImplicationByName(models.CreateTagInput{Name: "vocaloid"}, models.CreateTagInput{Name: "new_child"})
+	AssertError(t, err, "a cycle through a new tag should be rejected")
+
+	var after int
+	AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM tags").Scan(&after), "counting tags failed")
+	AssertEqual(t, after, before+1, "rejected implications should not create tags")
+}
+
+func TestTaggingAddsImpliedTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	miku := createTestTag(t, db, "hatsune_miku", models.TagCategoryCharacter)
+	vocaloid := createTestTag(t, db, "vocaloid", models.TagCategoryCopyright)
+	music := createTestTag(t, db, "music", models.TagCategoryGeneral)
+	_, err := db.CreateTagImplication(miku, vocaloid)
+	AssertNoError(t, err, "CreateTagImplication failed")
+	_, err = db.CreateTagImplication(vocaloid, music)
+	AssertNoError(t, err, "CreateTagImplication failed")
+
+	id := createTestMedia(t, db, "hatsune_miku")
+
+	tags, err := db.GetTagsByMediaID(id)
+	AssertNoError(t, err, "GetTagsByMediaID failed")
+	AssertEqual(t, tagNames(tags), []string{"music", "vocaloid", "hatsune_miku"}, "implied tags should be added")
+
+	media, err := db.GetMediaByID(id)
+	AssertNoError(t, err, "GetMediaByID failed")
+	AssertEqual(t, media.TagCountCopyright, 1, "copyright tag count")
+	AssertEqual(t, media.TagCount, 3, "total tag count")
+}
+
+func TestApplyTagImplication(t *testing.T) {
+	db := SetupTestDB(t)
+
+	tagged := createTestMedia(t, db, "hatsune_miku")
+	alreadyTagged := createTestMedia(t, db, "hatsune_miku", "vocaloid")
+	other := createTestMedia(t, db, "cat")
+
+	miku, err := db.GetTagByName("hatsune_miku")
+	AssertNoError(t, err, "GetTagByName failed")
+	vocaloid, err := db.GetTagByName("vocaloid")
+	AssertNoError(t, err, "GetTagByName failed")
+	music := createTestTag(t, db, "music", models.TagCategoryGeneral)
+
+	_, err = db.CreateTagImplication(vocaloid.ID, music)
+	AssertNoError(t, err, "CreateTagImplication failed")
+	id, err := db.CreateTagImplication(miku.ID, vocaloid.ID)
+	AssertNoError(t, err, "CreateTagImplication failed")
+
+	added, err := db.ApplyTagImplication(id)
+	AssertNoError(t, err, "ApplyTagImplication failed")
+	AssertEqual(t, added, 3, "tags added")
+
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "vocaloid music")), []int64{alreadyTagged, tagged}, "media with the child tag should be retagged")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "-music")), []int64{other}, "other media should be untouched")
+
+	_, err = db.ApplyTagImplication(9999)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
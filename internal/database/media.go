@@ -33,6 +33,29 @@ func (db *DB) GetMediaByID(id int64) (*models.Media, error) {
 	return media, nil
 }
 
+// GetMediaByMD5 retrieves a single media item by its file hash
+func (db *DB) GetMediaByMD5(md5 string) (*models.Media, error) {
+	query := "SELECT * FROM media WHERE md5 = ?"
+
+	media := &models.Media{}
+	err := db.QueryRow(query, md5).Scan(
+		&media.ID, &media.MD5, &media.FileExt, &media.MediaType, &media.MimeType, &media.FileSize,
+		&media.Width, &media.Height, &media.Duration, &media.Codec, &media.Rating, &media.IsFavorite,
+		&media.TagCount, &media.TagCountGeneral, &media.TagCountArtist, &media.TagCountCopyright,
+		&media.TagCountCharacter, &media.TagCountMetadata,
+		&media.ParentID, &media.HasChildren, &media.SourceURL, &media.CreatedAt, &media.UpdatedAt, &media.LastViewedAt,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, WrapQueryError("media", err)
+	}
+
+	return media, nil
+}
+
 // GetAllMedia retrieves all media
 func (db *DB) GetAllMedia() ([]*models.Media, error) {
 	query := "SELECT * FROM media ORDER BY id"
@@ -210,115 +233,48 @@ func (db *DB) ToggleFavorite(id int64) (*models.Media, error) {
 }
 
 func (db *DB) GetMediaBySearch(query *models.SearchQuery) (*models.SearchResult, error) {
-	sqlQuery := "SELECT DISTINCT m.* FROM media m"
-	var args []interface{}
-	var whereClauses []string
-
-	// For each included tag, join mediatags to ensure ALL tags exist (AND logic)
-	// Each tag gets its own JOIN with a unique alias
-	for i, tag := range query.IncludeTags {
-		mtAlias := fmt.Sprintf("mt_inc_%d", i)
-		tAlias := fmt.Sprintf("t_inc_%d", i)
-
-		sqlQuery += fmt.Sprintf(" INNER JOIN media_tags %s ON m.id = %s.media_id", mtAlias, mtAlias)
-		sqlQuery += fmt.Sprintf(" INNER JOIN tags %s ON %s.tag_id = %s.id", tAlias, mtAlias, tAlias)
-		whereClauses = append(whereClauses, fmt.Sprintf("%s.name = ?", tAlias))
-		args = append(args, tag)
-	}
-
-	// Excluded tags
-	for _, tag := range query.ExcludeTags {
-		whereClauses = append(whereClauses, `NOT EXISTS (
-			SELECT 1 FROM media_tags mt_exc
-			JOIN tags t_exc ON mt_exc.tag_id = t_exc.id
-			WHERE mt_exc.media_id = m.id AND t_exc.name = ?
-		)`)
-		args = append(args, tag)
-	}
-
-	// Optional filters
-	if query.IsFavorite != nil {
-		var fav int
-		if *query.IsFavorite {
-			fav = 1
-		}
-		whereClauses = append(whereClauses, "m.is_favorite = ?")
-		args = append(args, fav)
-	}
-
-	if len(query.Rating) > 0 {
-		var ratingPlaceholders []string
-		for _, rating := range query.Rating {
-			ratingPlaceholders = append(ratingPlaceholders, "?")
-			args = append(args, rating)
-		}
-		whereClauses = append(whereClauses, fmt.Sprintf("m.rating IN (%s)", strings.Join(ratingPlaceholders, ", ")))
-	}
-
-	if len(query.MediaTypes) > 0 {
-		var typePlaceholders []string
-		for _, mediaType := range query.MediaTypes {
-			typePlaceholders = append(typePlaceholders, "?")
-			args = append(args, mediaType)
-		}
-		whereClauses = append(whereClauses, fmt.Sprintf("m.media_type IN (%s)", strings.Join(typePlaceholders, ", ")))
-	}
-
-	if query.MinWidth != nil {
-		whereClauses = append(whereClauses, "m.width >= ?")
-		args = append(args, *query.MinWidth)
-	}
-	if query.MaxWidth != nil {
-		whereClauses = append(whereClauses, "m.width <= ?")
-		args = append(args, *query.MaxWidth)
+	// Resolve ordering first. A cursor carries its own order and random seed so that
+	// follow-up pages stay consistent with the page that produced it.
+	orderBy := query.OrderBy
+	if orderBy == "" {
+		orderBy = models.SortByID
+	}
+	orderAsc := query.OrderAsc
+	seed := query.RandomSeed
+
+	var cursor *searchCursor
+	var err error
+	forward := true
+	if query.BeforeCursor != "" {
+		cursor, err = decodeCursor(query.BeforeCursor)
+	} else if query.AfterCursor != "" {
+		cursor, err = decodeCursor(query.AfterCursor)
+		forward = false
+	} else if query.BeforeID == nil && query.AfterID != nil {
+		forward = false
 	}
-	if query.MinHeight != nil {
-		whereClauses = append(whereClauses, "m.height >= ?")
-		args = append(args, *query.MinHeight)
-	}
-	if query.MaxHeight != nil {
-		whereClauses = append(whereClauses, "m.height <= ?")
-		args = append(args, *query.MaxHeight)
-	}
-
-	if query.MinFileSize != nil {
-		whereClauses = append(whereClauses, "m.file_size >= ?")
-		args = append(args, *query.MinFileSize)
-	}
-	if query.MaxFileSize != nil {
-		whereClauses = append(whereClauses, "m.file_size <= ?")
-		args = append(args, *query.MaxFileSize)
+	if err != nil {
+		return nil, err
 	}
-
-	if query.HasParent != nil {
-		if *query.HasParent {
-			whereClauses = append(whereClauses, "m.parent_id IS NOT NULL")
-		} else {
-			whereClauses = append(whereClauses, "m.parent_id IS NULL")
-		}
+	if cursor != nil {
+		orderBy, orderAsc, seed = cursor.Order, cursor.Asc, cursor.Seed
 	}
-
-	if query.HasChildren != nil {
-		whereClauses = append(whereClauses, "m.has_children = ?")
-		var hasChildren int
-		if *query.HasChildren {
-			hasChildren = 1
+	if orderBy == models.SortByRandom && seed == 0 {
+		// A fresh seed would reshuffle the results, so later pages need the seed of the first
+		if query.BeforeID != nil || query.AfterID != nil || query.Offset > 0 {
+			return nil, fmt.Errorf("%w: later pages of a random order need the seed of the first page, as /order:random:<seed>", ErrInvalidInput)
 		}
-		args = append(args, hasChildren)
+		seed = newRandomSeed()
 	}
 
-	if query.ParentID != nil {
-		whereClauses = append(whereClauses, "m.parent_id = ?")
-		args = append(args, *query.ParentID)
+	keyExpr, err := sortKeyExpr(orderBy, seed)
+	if err != nil {
+		return nil, err
 	}
 
-	if query.CreatedAfter != nil {
-		whereClauses = append(whereClauses, "m.created_at >= ?")
-		args = append(args, query.CreatedAfter.Unix())
-	}
-	if query.CreatedBefore != nil {
-		whereClauses = append(whereClauses, "m.created_at <= ?")
-		args = append(args, query.CreatedBefore.Unix())
+	whereClauses, args, err := buildSearchConditions(query)
+	if err != nil {
+		return nil, err
 	}
 
 	// Capture the base args and where clauses for the count query *before* adding pagination
@@ -334,34 +290,45 @@ func (db *DB) GetMediaBySearch(query *models.SearchQuery) (*models.SearchResult,
 	}
 
 	// Count total results (excluding pagination)
-	countQuery := "SELECT COUNT(DISTINCT m.id) FROM media m"
-	for i := range query.IncludeTags {
-		mtAlias := fmt.Sprintf("mt_inc_%d", i)
-		tAlias := fmt.Sprintf("t_inc_%d", i)
-		countQuery += fmt.Sprintf(" INNER JOIN media_tags %s ON m.id = %s.media_id", mtAlias, mtAlias)
-		countQuery += fmt.Sprintf(" INNER JOIN tags %s ON %s.tag_id = %s.id", tAlias, mtAlias, tAlias)
-	}
-	countQuery += baseWhereClause
+	countQuery := "SELECT COUNT(*) FROM media m" + baseWhereClause
 
 	var totalCount int64
-	err := db.QueryRow(countQuery, baseArgs...).Scan(&totalCount)
+	err = db.QueryRow(countQuery, baseArgs...).Scan(&totalCount)
 	if err != nil {
 		return nil, WrapQueryError("media count", err)
 	}
 
-	// Apply cursor-based pagination filters (priority: BeforeID > AfterID)
-	sortAsc := false
+	hiddenCount, err := db.countHidden(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pages are fetched by scanning away from the cursor: in display order for the next page,
+	// and against it for the previous page, in which case the rows are reversed afterwards.
+	scanAsc := orderAsc == forward
+	cmp := "<"
+	if scanAsc {
+		cmp = ">"
+	}
+
+	// Apply cursor-based pagination filters (priority: cursors > BeforeID > AfterID)
+	var boundaryID *int64
 	if query.BeforeID != nil {
-		// Next page: get items before this ID (older items)
-		whereClauses = append(whereClauses, "m.id < ?")
-		args = append(args, *query.BeforeID)
+		boundaryID = query.BeforeID
 	} else if query.AfterID != nil {
-		// Previous page: get items after this ID (newer items)
-		// We must sort ASC to get the items *immediately* after the cursor,
-		// then reverse them to restore DESC order.
-		whereClauses = append(whereClauses, "m.id > ?")
-		args = append(args, *query.AfterID)
-		sortAsc = true
+		boundaryID = query.AfterID
+	}
+
+	if cursor != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("(%s, m.id) %s (?, ?)", keyExpr, cmp))
+		args = append(args, cursor.Key, cursor.ID)
+	} else if boundaryID != nil && orderBy == models.SortByID {
+		whereClauses = append(whereClauses, fmt.Sprintf("m.id %s ?", cmp))
+		args = append(args, *boundaryID)
+	} else if boundaryID != nil {
+		// Without a cursor, resume from the boundary row's current sort key
+		whereClauses = append(whereClauses, fmt.Sprintf("(%s, m.id) %s ((SELECT %s FROM media m WHERE m.id = ?), ?)", keyExpr, cmp, keyExpr))
+		args = append(args, *boundaryID, *boundaryID)
 	}
 
 	// Build Final WHERE clause
@@ -370,14 +337,17 @@ func (db *DB) GetMediaBySearch(query *models.SearchQuery) (*models.SearchResult,
 		whereClause = " WHERE " + strings.Join(whereClauses, " AND ")
 	}
 
-	// Add WHERE to main query
-	sqlQuery += whereClause
+	sqlQuery := fmt.Sprintf("SELECT m.*, %s AS sort_key FROM media m", keyExpr) + whereClause
 
-	// Add ORDER BY
-	if sortAsc {
-		sqlQuery += " ORDER BY m.id ASC"
+	// Add ORDER BY, breaking ties on ID so that cursors are unambiguous
+	direction := "DESC"
+	if scanAsc {
+		direction = "ASC"
+	}
+	if orderBy == models.SortByID {
+		sqlQuery += fmt.Sprintf(" ORDER BY m.id %s", direction)
 	} else {
-		sqlQuery += " ORDER BY m.id DESC"
+		sqlQuery += fmt.Sprintf(" ORDER BY sort_key %s, m.id %s", direction, direction)
 	}
 
 	// Determine limit (default: 20)
@@ -386,8 +356,8 @@ func (db *DB) GetMediaBySearch(query *models.SearchQuery) (*models.SearchResult,
 		limit = 20
 	}
 
-	// Apply pagination (priority: BeforeID > AfterID > Offset)
-	if query.BeforeID != nil || query.AfterID != nil {
+	// Apply pagination (priority: cursors > Offset)
+	if cursor != nil || boundaryID != nil {
 		sqlQuery += " LIMIT ?"
 		args = append(args, limit+1)
 	} else if query.Offset > 0 {
@@ -406,19 +376,23 @@ func (db *DB) GetMediaBySearch(query *models.SearchQuery) (*models.SearchResult,
 	defer rows.Close()
 
 	var mediaList []*models.Media
+	var sortKeys []interface{}
 	for rows.Next() {
 		media := &models.Media{}
+		var sortKey interface{}
 		err := rows.Scan(
 			&media.ID, &media.MD5, &media.FileExt, &media.MediaType, &media.MimeType, &media.FileSize,
 			&media.Width, &media.Height, &media.Duration, &media.Codec, &media.Rating, &media.IsFavorite,
 			&media.TagCount, &media.TagCountGeneral, &media.TagCountArtist, &media.TagCountCopyright,
 			&media.TagCountCharacter, &media.TagCountMetadata,
 			&media.ParentID, &media.HasChildren, &media.SourceURL, &media.CreatedAt, &media.UpdatedAt, &media.LastViewedAt,
+			&sortKey,
 		)
 		if err != nil {
 			return nil, WrapScanError("media search", err)
 		}
 		mediaList = append(mediaList, media)
+		sortKeys = append(sortKeys, sortKey)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -429,27 +403,35 @@ func (db *DB) GetMediaBySearch(query *models.SearchQuery) (*models.SearchResult,
 	hasMore := len(mediaList) > limit
 	if hasMore {
 		mediaList = mediaList[:limit]
+		sortKeys = sortKeys[:limit]
 	}
 
-	// If we sorted ASC (for AfterID/Previous Page), reverse the list
-	// to match the expected DESC order (Newest -> Oldest)
-	if sortAsc {
+	// If we scanned against the display order (for the previous page), reverse the list
+	// to restore the expected order
+	if !forward {
 		for i, j := 0, len(mediaList)-1; i < j; i, j = i+1, j-1 {
 			mediaList[i], mediaList[j] = mediaList[j], mediaList[i]
+			sortKeys[i], sortKeys[j] = sortKeys[j], sortKeys[i]
 		}
 	}
 
-	var firstID, lastID int64
+	result := &models.SearchResult{
+		Media:       mediaList,
+		TotalCount:  totalCount,
+		HasMore:     hasMore,
+		HiddenCount: hiddenCount,
+	}
+	if orderBy == models.SortByRandom {
+		result.RandomSeed = seed
+	}
+
 	if len(mediaList) > 0 {
-		firstID = mediaList[0].ID
-		lastID = mediaList[len(mediaList)-1].ID
+		last := len(mediaList) - 1
+		result.FirstID = mediaList[0].ID
+		result.LastID = mediaList[last].ID
+		result.FirstCursor = encodeCursor(&searchCursor{Order: orderBy, Asc: orderAsc, Seed: seed, Key: sortKeys[0], ID: mediaList[0].ID})
+		result.LastCursor = encodeCursor(&searchCursor{Order: orderBy, Asc: orderAsc, Seed: seed, Key: sortKeys[last], ID: mediaList[last].ID})
 	}
 
-	return &models.SearchResult{
-		Media:      mediaList,
-		TotalCount: totalCount,
-		FirstID:    firstID,
-		LastID:     lastID,
-		HasMore:    hasMore,
-	}, nil
+	return result, nil
 }
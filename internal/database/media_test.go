@@ -0,0 +1,644 @@
+package database
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"mybooru/internal/models"
+	"mybooru/internal/ui"
+	"mybooru/internal/ui/uitest"
+)
+
+var testMediaSeq int
+
+// createTestMedia inserts a media row tagged with the given tag names and returns its ID
+func createTestMedia(t *testing.T, db *DB, tags ...string) int64 {
+	t.Helper()
+
+	testMediaSeq++
+	id, err := db.CreateMedia(&models.CreateMediaInput{
+		MD5:       fmt.Sprintf("%032x", testMediaSeq),
+		FileExt:   "png",
+		MediaType: models.MediaTypeImage,
+		MimeType:  "image/png",
+		FileSize:  1024,
+		Rating:    models.RatingSafe,
+	})
+	AssertNoError(t, err, "CreateMedia failed")
+
+	var inputs []models.CreateTagInput
+	for _, tag := range tags {
+		inputs = append(inputs, models.CreateTagInput{Name: tag, Category: models.TagCategoryGeneral})
+	}
+	if len(inputs) > 0 {
+		AssertNoError(t, db.AddTagsToMediaTx(id, inputs), "AddTagsToMediaTx failed")
+	}
+
+	return id
+}
+
+// parseQuery parses a query string, failing the test on any diagnostics
+func parseQuery(t *testing.T, query string) *models.SearchQuery {
+	t.Helper()
+
+	q, diagnostics := ui.ParseQuery(query)
+	if len(diagnostics) > 0 {
+		t.Fatalf("unexpected diagnostics for %q: %+v", query, diagnostics)
+	}
+	return q
+}
+
+func searchIDs(t *testing.T, db *DB, query *models.SearchQuery) []int64 {
+	t.Helper()
+
+	result, err := db.GetMediaBySearch(query)
+	AssertNoError(t, err, "GetMediaBySearch failed")
+
+	ids := make([]int64, 0, len(result.Media))
+	for _, m := range result.Media {
+		ids = append(ids, m.ID)
+	}
+	AssertEqual(t, result.TotalCount, len(ids), "TotalCount should match result size")
+	return ids
+}
+
+func TestGetMediaBySearchOptionalTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	catOnly := createTestMedia(t, db, "cat")
+	catDog := createTestMedia(t, db, "cat", "dog")
+	catFox := createTestMedia(t, db, "cat", "fox")
+	dogOnly := createTestMedia(t, db, "dog")
+	catDogWet := createTestMedia(t, db, "cat", "dog", "wet")
+
+	tests := []struct {
+		name  string
+		query *models.SearchQuery
+		want  []int64
+	}{
+		{
+			name:  "include only",
+			query: parseQuery(t, "cat"),
+			want:  []int64{catDogWet, catFox, catDog, catOnly},
+		},
+		{
+			name:  "include with optional",
+			query: parseQuery(t, "cat ~dog ~fox"),
+			want:  []int64{catDogWet, catFox, catDog},
+		},
+		{
+			name:  "optional only",
+			query: parseQuery(t, "~fox ~dog"),
+			want:  []int64{catDogWet, dogOnly, catFox, catDog},
+		},
+		{
+			name:  "optional with exclude",
+			query: parseQuery(t, "cat ~dog ~fox -wet"),
+			want:  []int64{catFox, catDog},
+		},
+		{
+			name:  "optional tag that does not exist",
+			query: parseQuery(t, "~bird"),
+			want:  []int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AssertEqual(t, searchIDs(t, db, tt.query), tt.want, "search results mismatch")
+		})
+	}
+}
+
+func TestGetMediaBySearchOptionalTagsPagination(t *testing.T) {
+	db := SetupTestDB(t)
+
+	var want []int64
+	for i := 0; i < 5; i++ {
+		createTestMedia(t, db, "cat", fmt.Sprintf("filler_%d", i))
+		want = append([]int64{createTestMedia(t, db, "dog", fmt.Sprintf("filler_%d", i))}, want...)
+	}
+
+	query := parseQuery(t, "~dog ~fox")
+	query.Limit = 2
+	result, err := db.GetMediaBySearch(query)
+	AssertNoError(t, err, "GetMediaBySearch failed")
+	AssertEqual(t, result.TotalCount, 5, "TotalCount should only count optional matches")
+	AssertEqual(t, result.HasMore, true, "first page should have more")
+
+	var got []int64
+	for {
+		for _, m := range result.Media {
+			got = append(got, m.ID)
+		}
+		if !result.HasMore {
+			break
+		}
+		lastID := result.LastID
+		query.BeforeID = &lastID
+		result, err = db.GetMediaBySearch(query)
+		AssertNoError(t, err, "GetMediaBySearch with cursor failed")
+	}
+
+	AssertEqual(t, got, want, "paginated results mismatch")
+}
+
+func TestGetMediaBySearchWildcardTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	longHair := createTestMedia(t, db, "long_hair", "artist_bob")
+	shortHair := createTestMedia(t, db, "short_hair", "artist_alice")
+	blueEyes := createTestMedia(t, db, "blue_eyes")
+	plain := createTestMedia(t, db, "hairband", "artistic")
+
+	tests := []struct {
+		name  string
+		query *models.SearchQuery
+		want  []int64
+	}{
+		{
+			name:  "trailing wildcard",
+			query: parseQuery(t, "artist_*"),
+			want:  []int64{shortHair, longHair},
+		},
+		{
+			name:  "leading wildcard",
+			query: parseQuery(t, "*_hair"),
+			want:  []int64{shortHair, longHair},
+		},
+		{
+			name:  "inner wildcard",
+			query: parseQuery(t, "blue*eyes"),
+			want:  []int64{blueEyes},
+		},
+		{
+			name:  "case insensitive",
+			query: parseQuery(t, "LONG_*"),
+			want:  []int64{longHair},
+		},
+		{
+			name:  "underscore is literal",
+			query: parseQuery(t, "artist_* -artist_bob"),
+			want:  []int64{shortHair},
+		},
+		{
+			name:  "excluded wildcard",
+			query: parseQuery(t, "-*_hair"),
+			want:  []int64{plain, blueEyes},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AssertEqual(t, searchIDs(t, db, tt.query), tt.want, "search results mismatch")
+		})
+	}
+}
+
+func TestGetMediaBySearchWildcardCap(t *testing.T) {
+	db := SetupTestDB(t)
+
+	common := make([]string, maxWildcardTags)
+	for i := range common {
+		common[i] = fmt.Sprintf("wide_%d", i)
+	}
+	first := createTestMedia(t, db, common...)
+	second := createTestMedia(t, db, common...)
+	createTestMedia(t, db, "wide_rare")
+	other := createTestMedia(t, db, "narrow")
+
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "wide_*")), []int64{second, first}, "the least used matching tags should be dropped")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "-wide_*")), []int64{other}, "an excluded wildcard should not be capped")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "~narrow ~wide_*")), []int64{other, second, first}, "an included wildcard under OR is capped")
+
+	query := parseQuery(t, "")
+	query.Blacklist = parseQuery(t, "wide_*").Expr
+	AssertEqual(t, searchIDs(t, db, query), []int64{other}, "a blacklisted wildcard should not be capped")
+
+	result, err := db.GetMediaBySearch(query)
+	AssertNoError(t, err, "GetMediaBySearch failed")
+	AssertEqual(t, result.HiddenCount, 3, "hidden count should include every blacklisted media item")
+}
+
+func TestGlobToLike(t *testing.T) {
+	AssertEqual(t, globToLike("artist_*"), `artist\_%`, "trailing wildcard")
+	AssertEqual(t, globToLike("*100%*"), `%100\%%`, "percent is escaped")
+	AssertEqual(t, globToLike(`a\b*`), `a\\b%`, "backslash is escaped")
+}
+
+// pageThrough collects every page of a search by following LastCursor
+func pageThrough(t *testing.T, db *DB, query models.SearchQuery) []int64 {
+	t.Helper()
+
+	var ids []int64
+	for page := 0; page < 100; page++ {
+		result, err := db.GetMediaBySearch(&query)
+		AssertNoError(t, err, "GetMediaBySearch failed")
+		for _, m := range result.Media {
+			ids = append(ids, m.ID)
+		}
+		if !result.HasMore {
+			return ids
+		}
+		query.BeforeCursor = result.LastCursor
+	}
+	t.Fatalf("pagination did not terminate")
+	return nil
+}
+
+func TestGetMediaBySearchOrder(t *testing.T) {
+	db := SetupTestDB(t)
+
+	// Sizes include ties so that the ID tiebreaker is exercised across page boundaries
+	sizes := []int64{300, 100, 200, 100, 500, 200, 100}
+	ids := make([]int64, len(sizes))
+	for i, size := range sizes {
+		ids[i] = createTestMedia(t, db, "cat")
+		_, err := db.Exec("UPDATE media SET file_size = ? WHERE id = ?", size, ids[i])
+		AssertNoError(t, err, "failed to set file size")
+	}
+
+	sizeDesc := []int64{ids[4], ids[0], ids[5], ids[2], ids[6], ids[3], ids[1]}
+	sizeAsc := []int64{ids[1], ids[3], ids[6], ids[2], ids[5], ids[0], ids[4]}
+
+	t.Run("descending", func(t *testing.T) {
+		got := pageThrough(t, db, models.SearchQuery{OrderBy: models.SortByFileSize, Limit: 2})
+		AssertEqual(t, got, sizeDesc, "filesize desc mismatch")
+	})
+
+	t.Run("ascending", func(t *testing.T) {
+		got := pageThrough(t, db, models.SearchQuery{OrderBy: models.SortByFileSize, OrderAsc: true, Limit: 3})
+		AssertEqual(t, got, sizeAsc, "filesize asc mismatch")
+	})
+
+	t.Run("previous page via cursor", func(t *testing.T) {
+		first, err := db.GetMediaBySearch(&models.SearchQuery{OrderBy: models.SortByFileSize, Limit: 3})
+		AssertNoError(t, err, "first page failed")
+		second, err := db.GetMediaBySearch(&models.SearchQuery{Limit: 3, BeforeCursor: first.LastCursor})
+		AssertNoError(t, err, "second page failed")
+		back, err := db.GetMediaBySearch(&models.SearchQuery{Limit: 3, AfterCursor: second.FirstCursor})
+		AssertNoError(t, err, "previous page failed")
+
+		AssertEqual(t, back.FirstID, first.FirstID, "previous page should start where the first page did")
+		AssertEqual(t, back.LastID, first.LastID, "previous page should end where the first page did")
+	})
+
+	t.Run("boundary ID without cursor", func(t *testing.T) {
+		first, err := db.GetMediaBySearch(&models.SearchQuery{OrderBy: models.SortByFileSize, Limit: 3})
+		AssertNoError(t, err, "first page failed")
+		lastID := first.LastID
+		second, err := db.GetMediaBySearch(&models.SearchQuery{OrderBy: models.SortByFileSize, Limit: 3, BeforeID: &lastID})
+		AssertNoError(t, err, "second page failed")
+
+		var got []int64
+		for _, m := range second.Media {
+			got = append(got, m.ID)
+		}
+		AssertEqual(t, got, sizeDesc[3:6], "second page mismatch")
+	})
+
+	t.Run("random order is stable across pages", func(t *testing.T) {
+		got := pageThrough(t, db, models.SearchQuery{OrderBy: models.SortByRandom, Limit: 2})
+		AssertEqual(t, len(got), len(ids), "random order should return every item once")
+
+		seen := make(map[int64]bool)
+		for _, id := range got {
+			if seen[id] {
+				t.Fatalf("random order returned ID %d twice", id)
+			}
+			seen[id] = true
+		}
+	})
+
+	t.Run("random order paged by ID reuses the seed", func(t *testing.T) {
+		first, err := db.GetMediaBySearch(&models.SearchQuery{OrderBy: models.SortByRandom, Limit: 3})
+		AssertNoError(t, err, "first page failed")
+		if first.RandomSeed == 0 {
+			t.Fatal("random order should report its seed")
+		}
+
+		lastID := first.LastID
+		_, err = db.GetMediaBySearch(&models.SearchQuery{OrderBy: models.SortByRandom, Limit: 3, BeforeID: &lastID})
+		AssertError(t, err, "paging by ID without the seed should fail")
+
+		got := make(map[int64]bool)
+		query := models.SearchQuery{OrderBy: models.SortByRandom, RandomSeed: first.RandomSeed, Limit: 3}
+		for page := first; ; {
+			for _, m := range page.Media {
+				if got[m.ID] {
+					t.Fatalf("random order returned ID %d twice", m.ID)
+				}
+				got[m.ID] = true
+			}
+			if !page.HasMore {
+				break
+			}
+			lastID := page.LastID
+			query.BeforeID = &lastID
+			page, err = db.GetMediaBySearch(&query)
+			AssertNoError(t, err, "next page failed")
+		}
+		AssertEqual(t, len(got), len(ids), "seeded random order should return every item once")
+	})
+
+	t.Run("random order paged by offset reuses the seed", func(t *testing.T) {
+		first, err := db.GetMediaBySearch(&models.SearchQuery{OrderBy: models.SortByRandom, Limit: 3})
+		AssertNoError(t, err, "first page failed")
+
+		_, err = db.GetMediaBySearch(&models.SearchQuery{OrderBy: models.SortByRandom, Limit: 3, Offset: 3})
+		AssertError(t, err, "paging by offset without the seed should fail")
+
+		got := make(map[int64]bool)
+		for offset := 0; offset < len(ids); offset += 3 {
+			page, err := db.GetMediaBySearch(&models.SearchQuery{OrderBy: models.SortByRandom, RandomSeed: first.RandomSeed, Limit: 3, Offset: offset})
+			AssertNoError(t, err, "page failed")
+			for _, m := range page.Media {
+				if got[m.ID] {
+					t.Fatalf("random order returned ID %d twice", m.ID)
+				}
+				got[m.ID] = true
+			}
+		}
+		AssertEqual(t, len(got), len(ids), "seeded random order should return every item once")
+	})
+
+	t.Run("malformed cursor", func(t *testing.T) {
+		_, err := db.GetMediaBySearch(&models.SearchQuery{BeforeCursor: "not a cursor"})
+		AssertError(t, err, "malformed cursor should fail")
+	})
+}
+
+func TestGetMediaBySearchBooleanExpressions(t *testing.T) {
+	db := SetupTestDB(t)
+
+	cat := createTestMedia(t, db, "cat")
+	dog := createTestMedia(t, db, "dog", "monochrome")
+	catDog := createTestMedia(t, db, "cat", "dog")
+	bird := createTestMedia(t, db, "bird", "monochrome")
+	_, err := db.Exec("UPDATE media SET rating = 'explicit' WHERE id = ?", catDog)
+	AssertNoError(t, err, "failed to set rating")
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{query: "cat or dog", want: []int64{catDog, dog, cat}},
+		{query: "(cat or dog) -monochrome", want: []int64{catDog, cat}},
+		{query: "(cat or dog) -(/rating:e ~monochrome ~cat)", want: []int64{dog, cat}},
+		{query: "-(cat or dog)", want: []int64{bird}},
+		{query: "monochrome -(-bird)", want: []int64{bird}},
+		{query: "cat /rating:e or bird", want: []int64{bird, catDog}},
+		{query: "cat -/rating:e", want: []int64{cat}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			AssertEqual(t, searchIDs(t, db, parseQuery(t, tt.query)), tt.want, "search results mismatch")
+		})
+	}
+}
+
+func TestGetMediaBySearchDateFilters(t *testing.T) {
+	db := SetupTestDB(t)
+
+	now := time.Now()
+	old := createTestMedia(t, db, "cat")
+	recent := createTestMedia(t, db, "cat")
+	unseen := createTestMedia(t, db, "cat")
+
+	_, err := db.Exec("UPDATE media SET created_at = ?, last_viewed_at = ? WHERE id = ?",
+		now.AddDate(-1, 0, 0).Unix(), now.AddDate(0, 0, -60).Unix(), old)
+	AssertNoError(t, err, "failed to age media")
+	_, err = db.Exec("UPDATE media SET last_viewed_at = ? WHERE id = ?", now.Add(-time.Hour).Unix(), recent)
+	AssertNoError(t, err, "failed to view media")
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{query: "/age:<7d", want: []int64{unseen, recent}},
+		{query: "/age:>30d", want: []int64{old}},
+		{query: "/viewed:<30d", want: []int64{recent}},
+		{query: "/viewed:>30d", want: []int64{old}},
+		{query: "/viewed:never", want: []int64{unseen}},
+		{query: "/viewed:any", want: []int64{recent, old}},
+		{query: fmt.Sprintf("/date:%d", now.Year()-1), want: []int64{old}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			AssertEqual(t, searchIDs(t, db, parseQuery(t, tt.query)), tt.want, "search results mismatch")
+		})
+	}
+}
+
+func TestGetMediaBySearchDimensionFilters(t *testing.T) {
+	db := SetupTestDB(t)
+
+	landscape := createTestMedia(t, db, "cat")
+	portrait := createTestMedia(t, db, "cat")
+	square := createTestMedia(t, db, "cat")
+	clip := createTestMedia(t, db, "cat")
+
+	dimensions := []struct {
+		id            int64
+		width, height int
+		duration      interface{}
+	}{
+		{id: landscape, width: 1920, height: 1080},
+		{id: portrait, width: 1000, height: 1500},
+		{id: square, width: 800, height: 800},
+		{id: clip, width: 1280, height: 720, duration: 95.4},
+	}
+	for _, d := range dimensions {
+		_, err := db.Exec("UPDATE media SET width = ?, height = ?, duration = ? WHERE id = ?", d.width, d.height, d.duration, d.id)
+		AssertNoError(t, err, "failed to set dimensions")
+	}
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{query: "/ratio:16:9", want: []int64{clip, landscape}},
+		{query: "/ratio:>1", want: []int64{clip, landscape}},
+		{query: "/ratio:<1", want: []int64{portrait}},
+		{query: "/ratio:1", want: []int64{square}},
+		{query: "/mpixels:>1.4", want: []int64{portrait, landscape}},
+		{query: "/mpixels:..1", want: []int64{clip, square}},
+		{query: "/duration:>30s", want: []int64{clip}},
+		{query: "/duration:1m..5m", want: []int64{clip}},
+		{query: "/duration:95", want: []int64{clip}},
+		{query: "/duration:<30s", want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			AssertEqual(t, searchIDs(t, db, parseQuery(t, tt.query)), tt.want, "search results mismatch")
+		})
+	}
+}
+
+func TestGetMediaBySearchTagCountFilters(t *testing.T) {
+	db := SetupTestDB(t)
+
+	untagged := createTestMedia(t, db)
+	sketch := createTestMedia(t, db, "cat", "sketch")
+	credited := createTestMedia(t, db, "cat")
+	AssertNoError(t, db.AddTagsToMediaTx(credited, []models.CreateTagInput{
+		{Name: "some_artist", Category: models.TagCategoryArtist},
+		{Name: "some_character", Category: models.TagCategoryCharacter},
+	}), "AddTagsToMediaTx failed")
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{query: "/tagcount:0", want: []int64{untagged}},
+		{query: "/tagcount:<3", want: []int64{sketch, untagged}},
+		{query: "/tagcount:>2", want: []int64{credited}},
+		{query: "/arttags:0", want: []int64{sketch, untagged}},
+		{query: "/chartags:>=1", want: []int64{credited}},
+		{query: "/gentags:1..2", want: []int64{credited, sketch}},
+		{query: "cat /arttags:0", want: []int64{sketch}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			AssertEqual(t, searchIDs(t, db, parseQuery(t, tt.query)), tt.want, "search results mismatch")
+		})
+	}
+}
+
+func TestGetMediaBySearchBlacklist(t *testing.T) {
+	db := SetupTestDB(t)
+
+	gore := createTestMedia(t, db, "cat", "gore")
+	spider := createTestMedia(t, db, "cat", "spider")
+	cartoonSpider := createTestMedia(t, db, "cat", "spider", "cartoon")
+	plain := createTestMedia(t, db, "cat")
+	createTestMedia(t, db, "dog", "gore")
+
+	blacklist, diagnostics := ui.ParseBlacklist([]string{"gore", "spider -cartoon"})
+	AssertEqual(t, len(diagnostics), 0, "blacklist diagnostics")
+
+	query := parseQuery(t, "cat")
+	query.Blacklist = blacklist
+	result, err := db.GetMediaBySearch(query)
+	AssertNoError(t, err, "GetMediaBySearch failed")
+	AssertEqual(t, searchIDs(t, db, query), []int64{plain, cartoonSpider}, "blacklisted media should be hidden")
+	AssertEqual(t, result.TotalCount, 2, "TotalCount should exclude hidden media")
+	AssertEqual(t, result.HiddenCount, 2, "HiddenCount should count hidden matches only")
+
+	query = parseQuery(t, "cat /blacklist:off")
+	query.Blacklist = blacklist
+	result, err = db.GetMediaBySearch(query)
+	AssertNoError(t, err, "GetMediaBySearch failed")
+	AssertEqual(t, searchIDs(t, db, query), []int64{plain, cartoonSpider, spider, gore}, "/blacklist:off should show everything")
+	AssertEqual(t, result.HiddenCount, 0, "nothing should be hidden with /blacklist:off")
+
+	query = parseQuery(t, "cat")
+	result, err = db.GetMediaBySearch(query)
+	AssertNoError(t, err, "GetMediaBySearch failed")
+	AssertEqual(t, result.HiddenCount, 0, "nothing should be hidden without a blacklist")
+}
+
+func TestGetMediaBySearchAllowedRatings(t *testing.T) {
+	db := SetupTestDB(t)
+
+	safe := createTestMedia(t, db, "cat")
+	explicit := createTestMedia(t, db, "cat")
+	rating := models.RatingExplicit
+	AssertNoError(t, db.UpdateMedia(explicit, &models.UpdateMediaInput{Rating: &rating}), "UpdateMedia failed")
+
+	query := parseQuery(t, "cat /rating:e")
+	query.AllowedRatings = []models.Rating{models.RatingSafe}
+	AssertEqual(t, searchIDs(t, db, query), []int64{}, "allowed ratings should override the query")
+
+	query = parseQuery(t, "cat | /rating:e")
+	query.AllowedRatings = []models.Rating{models.RatingSafe}
+	AssertEqual(t, searchIDs(t, db, query), []int64{safe}, "allowed ratings should apply across OR branches")
+
+	query = parseQuery(t, "cat")
+	query.AllowedRatings = []models.Rating{models.RatingSafe, models.RatingExplicit}
+	AssertEqual(t, searchIDs(t, db, query), []int64{explicit, safe}, "every allowed rating should be listed")
+}
+
+func TestGetMediaByMD5(t *testing.T) {
+	db := SetupTestDB(t)
+
+	id := createTestMedia(t, db)
+	media, err := db.GetMediaByID(id)
+	AssertNoError(t, err, "GetMediaByID failed")
+
+	byHash, err := db.GetMediaByMD5(media.MD5)
+	AssertNoError(t, err, "GetMediaByMD5 failed")
+	AssertEqual(t, byHash.ID, id, "media ID")
+
+	_, err = db.GetMediaByMD5("missing")
+	AssertError(t, err, "GetMediaByMD5 should fail for an unknown hash")
+}
+
+func TestGetMediaBySearchIdentityFilters(t *testing.T) {
+	db := SetupTestDB(t)
+
+	png := createTestMedia(t, db)
+	codec := "hevc"
+	testMediaSeq++
+	hash := fmt.Sprintf("%032x", testMediaSeq)
+	video, err := db.CreateMedia(&models.CreateMediaInput{
+		MD5:       hash,
+		FileExt:   "mp4",
+		MediaType: models.MediaTypeVideo,
+		MimeType:  "video/hevc",
+		FileSize:  1024,
+		Codec:     &codec,
+		Rating:    models.RatingSafe,
+	})
+	AssertNoError(t, err, "CreateMedia failed")
+	last := createTestMedia(t, db)
+
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, fmt.Sprintf("/id:%d", video))), []int64{video}, "/id: exact")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, fmt.Sprintf("/id:%d..%d", video, last))), []int64{last, video}, "/id: range")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, fmt.Sprintf("/id:<%d", video))), []int64{png}, "/id: comparison")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "/md5:"+hash+".mp4")), []int64{video}, "/md5: with a file name")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "/ext:MP4")), []int64{video}, "/ext:")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "/ext:png /ext:mp4")), []int64{last, video, png}, "repeated /ext: should match either")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "/codec:h265")), []int64{video}, "/codec: alias")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "/codec:vp9")), []int64{}, "/codec: with no matches")
+	AssertEqual(t, searchIDs(t, db, parseQuery(t, "/mime:video/HEVC")), []int64{video}, "/mime:")
+}
+
+func TestFormatQueryPreservesResults(t *testing.T) {
+	db := SetupTestDB(t)
+
+	rng := rand.New(rand.NewSource(1))
+	vocabulary := []string{"cat", "dog", "fox", "blue_hair", "long_hair", "solo"}
+	ratings := []models.Rating{models.RatingSafe, models.RatingQuestionable, models.RatingExplicit}
+	for i := 0; i < 40; i++ {
+		var tags []string
+		for _, tag := range vocabulary {
+			if rng.Intn(3) == 0 {
+				tags = append(tags, tag)
+			}
+		}
+		id := createTestMedia(t, db, tags...)
+		rating := ratings[rng.Intn(len(ratings))]
+		favorite := rng.Intn(2) == 0
+		AssertNoError(t, db.UpdateMedia(id, &models.UpdateMediaInput{Rating: &rating, IsFavorite: &favorite}), "UpdateMedia failed")
+	}
+
+	tags := []string{"cat", "Dog", "fox", "*_hair", "solo"}
+	filters := []string{"/rating:s", "/rating:e", "/favorite:true", "/gentags:2..3", "/id:>20", "/id:..10"}
+	for i := 0; i < 300; i++ {
+		query := uitest.RandomQuery(rng, 2, tags, filters)
+		original := parseQuery(t, query)
+		original.Limit = 100
+		formatted := ui.FormatQuery(original)
+		reparsed := parseQuery(t, formatted)
+		reparsed.Limit = 100
+
+		AssertEqual(t, searchIDs(t, db, reparsed), searchIDs(t, db, original), fmt.Sprintf("%q formatted as %q", query, formatted))
+	}
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"mybooru/internal/models"
+)
+
+// randomOrderModulus is the prime used to scramble IDs for the random sort order.
+// Multiplying by a seed modulo a prime permutes the IDs, so the order is stable for a given seed.
+const randomOrderModulus = 2147483647
+
+// sortKeyExpr returns the SQL expression media are ordered by for the given sort field.
+// Nullable columns are coalesced to -1 so that row-value cursor comparisons never see NULL.
+func sortKeyExpr(field models.SortField, seed int64) (string, error) {
+	switch field {
+	case "", models.SortByID:
+		return "m.id", nil
+	case models.SortByFileSize:
+		return "m.file_size", nil
+	case models.SortByWidth:
+		return "COALESCE(m.width, -1)", nil
+	case models.SortByHeight:
+		return "COALESCE(m.height, -1)", nil
+	case models.SortByPixels:
+		return "COALESCE(m.width * m.height, -1)", nil
+	case models.SortByDuration:
+		return "COALESCE(m.duration, -1)", nil
+	case models.SortByTagCount:
+		return "m.tag_count", nil
+	case models.SortByLastViewed:
+		return "COALESCE(m.last_viewed_at, -1)", nil
+	case models.SortByUpdated:
+		return "m.updated_at", nil
+	case models.SortByRandom:
+		return fmt.Sprintf("((m.id * %d) %% %d)", seed, randomOrderModulus), nil
+	default:
+		return "", fmt.Errorf("%w: unknown sort order %q", ErrInvalidInput, field)
+	}
+}
+
+// newRandomSeed picks a seed for the random sort order
+func newRandomSeed() int64 {
+	return rand.Int63n(randomOrderModulus-1) + 1
+}
+
+// searchCursor is the decoded form of the opaque pagination cursors in SearchResult.
+// It records the sort key and ID of the boundary row so that non-id orders can resume
+// exactly where the previous page stopped, even if that row has since changed.
+type searchCursor struct {
+	Order models.SortField `json:"o"`
+	Asc   bool             `json:"a,omitempty"`
+	Seed  int64            `json:"s,omitempty"`
+	Key   interface{}      `json:"k"`
+	ID    int64            `json:"i"`
+}
+
+func encodeCursor(c *searchCursor) string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	c := &searchCursor{}
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+
+	// Restore the sort key to the type SQLite handed out so comparisons stay exact
+	if num, ok := c.Key.(json.Number); ok {
+		if i, err := num.Int64(); err == nil {
+			c.Key = i
+		} else if f, err := num.Float64(); err == nil {
+			c.Key = f
+		} else {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"mybooru/internal/models"
+)
+
+// GetRelatedTags finds the tags that occur most often among all media matching a search, not just
+// the current page. At most limit tags are returned per category, grouped by category in order.
+func (db *DB) GetRelatedTags(query *models.SearchQuery, limit int) ([]*models.RelatedTagGroup, error) {
+	matching, args, err := matchingMediaSQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM ("+matching+")", args...).Scan(&total); err != nil {
+		return nil, WrapQueryError("media count", err)
+	}
+	if total == 0 {
+		return []*models.RelatedTagGroup{}, nil
+	}
+
+	relatedQuery := `
+		SELECT id, name, category, usage_count, created_at, frequency
+		FROM (
+			SELECT t.id, t.name, t.category, t.usage_count, t.created_at, COUNT(*) AS frequency,
+			       ROW_NUMBER() OVER (PARTITION BY t.category ORDER BY COUNT(*) DESC, t.usage_count DESC, t.name) AS position
+			FROM media_tags mt
+			JOIN tags t ON mt.tag_id = t.id
+			WHERE mt.media_id IN (` + matching + `)
+			GROUP BY t.id
+		)
+		WHERE position <= ?
+		ORDER BY category, position
+	`
+
+	rows, err := db.Query(relatedQuery, append(args, limit)...)
+	if err != nil {
+		return nil, WrapQueryError("related tags", err)
+	}
+	defer rows.Close()
+
+	groups := []*models.RelatedTagGroup{}
+	for rows.Next() {
+		tag := &models.Tag{}
+		related := &models.RelatedTag{Tag: tag}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Category, &tag.UsageCount, &tag.CreatedAt, &related.Frequency); err != nil {
+			return nil, WrapScanError("related tag", err)
+		}
+
+		related.Share = float64(related.Frequency) / float64(total)
+		if tag.UsageCount > 0 {
+			related.Specificity = float64(related.Frequency) / float64(tag.UsageCount)
+		}
+
+		if len(groups) == 0 || groups[len(groups)-1].Category != tag.Category {
+			groups = append(groups, &models.RelatedTagGroup{Category: tag.Category})
+		}
+		group := groups[len(groups)-1]
+		group.Tags = append(group.Tags, related)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("related tag", err)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"testing"
+
+	"mybooru/internal/models"
+)
+
+func TestGetRelatedTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	createTestMedia(t, db, "cat", "solo", "outdoors")
+	createTestMedia(t, db, "cat", "solo")
+	third := createTestMedia(t, db, "cat", "indoors")
+	createTestMedia(t, db, "dog", "solo", "outdoors")
+	AssertNoError(t, db.AddTagsToMediaTx(third, []models.CreateTagInput{
+		{Name: "some_artist", Category: models.TagCategoryArtist},
+	}), "AddTagsToMediaTx failed")
+
+	groups, err := db.GetRelatedTags(parseQuery(t, "cat"), 10)
+	AssertNoError(t, err, "GetRelatedTags failed")
+	AssertEqual(t, len(groups), 2, "group count")
+	AssertEqual(t, groups[0].Category, models.TagCategoryGeneral, "first group category")
+	AssertEqual(t, groups[1].Category, models.TagCategoryArtist, "second group category")
+
+	var names []string
+	for _, r := range groups[0].Tags {
+		names = append(names, r.Tag.Name)
+	}
+	AssertEqual(t, names, []string{"cat", "solo", "outdoors", "indoors"}, "general tags should be ordered by frequency")
+
+	solo := groups[0].Tags[1]
+	AssertEqual(t, solo.Frequency, 2, "solo frequency")
+	AssertEqual(t, solo.Share, 2.0/3.0, "solo share")
+	AssertEqual(t, solo.Specificity, 2.0/3.0, "solo specificity")
+	AssertEqual(t, groups[0].Tags[3].Specificity, 1.0, "indoors only occurs in the results")
+
+	groups, err = db.GetRelatedTags(parseQuery(t, "cat"), 2)
+	AssertNoError(t, err, "GetRelatedTags failed")
+	AssertEqual(t, len(groups[0].Tags), 2, "limit should apply per category")
+	AssertEqual(t, len(groups[1].Tags), 1, "artist group")
+
+	groups, err = db.GetRelatedTags(parseQuery(t, "bird"), 10)
+	AssertNoError(t, err, "GetRelatedTags failed")
+	AssertEqual(t, len(groups), 0, "no results should give no related tags")
+}
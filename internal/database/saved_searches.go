@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"mybooru/internal/models"
+)
+
+// validateSavedSearchName checks that a name can be referenced as /saved:name inside a query
+func validateSavedSearchName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: saved search name cannot be empty", ErrInvalidInput)
+	}
+	if strings.ContainsAny(name, " \t\r\n()") {
+		return fmt.Errorf("%w: saved search name %q cannot contain whitespace or parentheses", ErrInvalidInput, name)
+	}
+	return nil
+}
+
+// checkSavedSearchNameFree returns ErrConstraintViolation if another saved search already uses name.
+// Names are compared case-insensitively, since /saved: lookups are case-insensitive.
+func checkSavedSearchNameFree(tx *sql.Tx, name string, exceptID int64) error {
+	var existing string
+	err := tx.QueryRow("SELECT name FROM saved_searches WHERE name = ? COLLATE NOCASE AND id != ?", name, exceptID).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf("%w: saved search with name %s already exists", ErrConstraintViolation, existing)
+	}
+	if err != sql.ErrNoRows {
+		return WrapQueryError("saved searches", err)
+	}
+	return nil
+}
+
+// GetSavedSearches retrieves all saved searches ordered by name
+func (db *DB) GetSavedSearches() ([]*models.SavedSearch, error) {
+	query := `
+		SELECT id, name, query, created_at, last_used_at
+		FROM saved_searches
+		ORDER BY name COLLATE NOCASE
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, WrapQueryError("saved searches", err)
+	}
+	defer rows.Close()
+
+	var searches []*models.SavedSearch
+	for rows.Next() {
+		s := &models.SavedSearch{}
+		if err := rows.Scan(&s.ID, &s.Name, &s.Query, &s.CreatedAt, &s.LastUsedAt); err != nil {
+			return nil, WrapScanError("saved search", err)
+		}
+		searches = append(searches, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("saved search", err)
+	}
+
+	return searches, nil
+}
+
+// GetSavedSearchByName retrieves a single saved search by name (case-insensitive)
+func (db *DB) GetSavedSearchByName(name string) (*models.SavedSearch, error) {
+	query := `
+		SELECT id, name, query, created_at, last_used_at
+		FROM saved_searches
+		WHERE name = ? COLLATE NOCASE
+	`
+
+	s := &models.SavedSearch{}
+	err := db.QueryRow(query, name).Scan(&s.ID, &s.Name, &s.Query, &s.CreatedAt, &s.LastUsedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, WrapGetByNameError("saved search", err)
+	}
+
+	return s, nil
+}
+
+// CreateSavedSearch saves a query under a unique name
+func (db *DB) CreateSavedSearch(name, query string) (int64, error) {
+	if err := validateSavedSearchName(name); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	if err := checkSavedSearchNameFree(tx, name, 0); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO saved_searches (name, query, created_at) VALUES (?, ?, ?)", name, query, time.Now().Unix())
+	if err != nil {
+		return 0, WrapCreateError("saved search", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, WrapLastInsertIDError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, WrapTransactionCommitError(err)
+	}
+
+	return id, nil
+}
+
+// RenameSavedSearch changes the name of a saved search
+func (db *DB) RenameSavedSearch(id int64, name string) error {
+	if err := validateSavedSearchName(name); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	if err := checkSavedSearchNameFree(tx, name, id); err != nil {
+		return err
+	}
+
+	if err := updateSavedSearchRow(tx, "UPDATE saved_searches SET name = ? WHERE id = ?", name, id); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return WrapTransactionCommitError(err)
+	}
+
+	return nil
+}
+
+// UpdateSavedSearch replaces the query of a saved search
+func (db *DB) UpdateSavedSearch(id int64, query string) error {
+	return updateSavedSearchRow(db, "UPDATE saved_searches SET query = ? WHERE id = ?", query, id)
+}
+
+// TouchSavedSearch records that a saved search was just run
+func (db *DB) TouchSavedSearch(id int64) error {
+	return updateSavedSearchRow(db, "UPDATE saved_searches SET last_used_at = ? WHERE id = ?", time.Now().Unix(), id)
+}
+
+// DeleteSavedSearch deletes a saved search by ID
+func (db *DB) DeleteSavedSearch(id int64) error {
+	result, err := db.Exec("DELETE FROM saved_searches WHERE id = ?", id)
+	if err != nil {
+		return WrapDeleteError("saved search", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return WrapRowsAffectedError(err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// execer is satisfied by both *DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// updateSavedSearchRow runs an UPDATE against a single saved search, returning ErrNotFound if no row matched
+func updateSavedSearchRow(e execer, query string, args ...interface{}) error {
+	result, err := e.Exec(query, args...)
+	if err != nil {
+		return WrapUpdateError("saved search", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return WrapRowsAffectedError(err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
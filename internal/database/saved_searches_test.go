@@ -0,0 +1,70 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSavedSearchCRUD(t *testing.T) {
+	db := SetupTestDB(t)
+
+	id, err := db.CreateSavedSearch("cats", "cat -dog")
+	AssertNoError(t, err, "CreateSavedSearch failed")
+	_, err = db.CreateSavedSearch("birds", "bird")
+	AssertNoError(t, err, "CreateSavedSearch failed")
+
+	tests := []struct {
+		name    string
+		create  string
+		wantErr error
+	}{
+		{name: "duplicate name", create: "Cats", wantErr: ErrConstraintViolation},
+		{name: "empty name", create: "", wantErr: ErrInvalidInput},
+		{name: "name with whitespace", create: "my cats", wantErr: ErrInvalidInput},
+		{name: "name with parenthesis", create: "cats)", wantErr: ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.CreateSavedSearch(tt.create, "cat")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	saved, err := db.GetSavedSearchByName("CATS")
+	AssertNoError(t, err, "GetSavedSearchByName failed")
+	AssertEqual(t, saved.Query, "cat -dog", "query mismatch")
+	AssertEqual(t, saved.LastUsedAt.Valid, false, "new saved search should be unused")
+
+	AssertNoError(t, db.TouchSavedSearch(id), "TouchSavedSearch failed")
+	AssertNoError(t, db.UpdateSavedSearch(id, "cat"), "UpdateSavedSearch failed")
+	AssertNoError(t, db.RenameSavedSearch(id, "kitties"), "RenameSavedSearch failed")
+	if !errors.Is(db.RenameSavedSearch(id, "birds"), ErrConstraintViolation) {
+		t.Error("renaming onto an existing name should fail")
+	}
+	AssertNoError(t, db.RenameSavedSearch(id, "Kitties"), "renaming a search to a different case of its own name should work")
+
+	saved, err = db.GetSavedSearchByName("kitties")
+	AssertNoError(t, err, "GetSavedSearchByName failed")
+	AssertEqual(t, saved.Query, "cat", "updated query mismatch")
+	AssertEqual(t, saved.LastUsedAt.Valid, true, "touched saved search should have last_used_at")
+
+	searches, err := db.GetSavedSearches()
+	AssertNoError(t, err, "GetSavedSearches failed")
+	AssertEqual(t, len(searches), 2, "saved search count")
+	AssertEqual(t, searches[0].Name, "birds", "saved searches should be ordered by name")
+
+	AssertNoError(t, db.DeleteSavedSearch(id), "DeleteSavedSearch failed")
+	for name, err := range map[string]error{
+		"get":    func() error { _, err := db.GetSavedSearchByName("kitties"); return err }(),
+		"delete": db.DeleteSavedSearch(id),
+		"update": db.UpdateSavedSearch(id, "dog"),
+		"rename": db.RenameSavedSearch(id, "dogs"),
+		"touch":  db.TouchSavedSearch(id),
+	} {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s of a deleted saved search: expected ErrNotFound, got %v", name, err)
+		}
+	}
+}
@@ -97,6 +97,30 @@ CREATE TABLE IF NOT EXISTS saved_searches (
   last_used_at INTEGER
 );
 
+CREATE TABLE IF NOT EXISTS bulk_tag_edits (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  description TEXT NOT NULL,
+  matched_count INTEGER NOT NULL,
+  changed_count INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL,
+  undone_at INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS bulk_tag_edit_changes (
+  edit_id INTEGER NOT NULL REFERENCES bulk_tag_edits(id) ON DELETE CASCADE,
+  media_id INTEGER NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+  tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  added INTEGER NOT NULL CHECK(added IN (0, 1)),
+  PRIMARY KEY (edit_id, media_id, tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS bulk_tag_edit_categories (
+  edit_id INTEGER NOT NULL REFERENCES bulk_tag_edits(id) ON DELETE CASCADE,
+  tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  old_category INTEGER NOT NULL,
+  PRIMARY KEY (edit_id, tag_id)
+);
+
 CREATE TABLE IF NOT EXISTS collections (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   name TEXT NOT NULL UNIQUE,
@@ -137,6 +161,9 @@ CREATE INDEX IF NOT EXISTS idx_view_history_composite ON view_history(media_id,
 
 CREATE INDEX IF NOT EXISTS idx_search_history_searched ON search_history(searched_at DESC);
 
+CREATE INDEX IF NOT EXISTS idx_bulk_tag_edit_changes_media ON bulk_tag_edit_changes(media_id);
+CREATE INDEX IF NOT EXISTS idx_bulk_tag_edit_changes_tag ON bulk_tag_edit_changes(tag_id);
+
 CREATE INDEX IF NOT EXISTS idx_collection_media_pool ON collection_media(collection_id, position);
 CREATE INDEX IF NOT EXISTS idx_collection_media_post ON collection_media(media_id);
 
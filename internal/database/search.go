@@ -0,0 +1,398 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"mybooru/internal/models"
+)
+
+// maxWildcardTags caps how many tags a single wildcard pattern may expand to.
+// Only the most used matching tags are kept so that broad patterns like "*" stay cheap.
+// Patterns that exclude media are never capped, since dropping tags would let media through.
+const maxWildcardTags = 100
+
+// wildcardTagsSubquery expands a LIKE pattern to the IDs of the matching tags.
+// LIKE is case-insensitive for ASCII, which keeps it consistent with the NOCASE collation on tags.name.
+const wildcardTagsSubquery = `SELECT id FROM tags WHERE name LIKE ? ESCAPE '\'`
+
+// globToLike converts a glob-style tag pattern (artist_*, *_hair, blue*eyes) into a LIKE pattern,
+// escaping the LIKE metacharacters that commonly appear in tag names
+func globToLike(pattern string) string {
+	var sb strings.Builder
+	for _, c := range pattern {
+		switch c {
+		case '\\', '%', '_':
+			sb.WriteRune('\\')
+			sb.WriteRune(c)
+		case '*':
+			sb.WriteRune('%')
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// buildSearchConditions compiles a search query into WHERE clauses over "media m" and their arguments,
+// leaving out blacklisted media.
+// Pagination and ordering are not included, so the result can be shared by every query that
+// needs to select the same set of media.
+func buildSearchConditions(query *models.SearchQuery) ([]string, []interface{}, error) {
+	clauses, args, err := filterConditions(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if query.Expr != nil {
+		clause, exprArgs, err := compileQueryNode(query.Expr, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		clauses = append(clauses, clause)
+		args = append(args, exprArgs...)
+	}
+
+	if query.Blacklist != nil && !query.IgnoreBlacklist {
+		clause, blacklistArgs, err := compileQueryNode(query.Blacklist, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		clauses = append(clauses, "NOT ("+clause+")")
+		args = append(args, blacklistArgs...)
+	}
+
+	return clauses, args, nil
+}
+
+// countHidden counts the media matching a search that its blacklist hides
+func (db *DB) countHidden(query *models.SearchQuery) (int64, error) {
+	if query.Blacklist == nil || query.IgnoreBlacklist {
+		return 0, nil
+	}
+
+	unfiltered := *query
+	unfiltered.Blacklist = nil
+	clauses, args, err := buildSearchConditions(&unfiltered)
+	if err != nil {
+		return 0, err
+	}
+
+	clause, blacklistArgs, err := compileQueryNode(query.Blacklist, false)
+	if err != nil {
+		return 0, err
+	}
+	clauses = append(clauses, clause)
+	args = append(args, blacklistArgs...)
+
+	var hidden int64
+	err = db.QueryRow("SELECT COUNT(*) FROM media m WHERE "+strings.Join(clauses, " AND "), args...).Scan(&hidden)
+	if err != nil {
+		return 0, WrapQueryError("hidden media count", err)
+	}
+	return hidden, nil
+}
+
+// matchingMediaSQL returns a subquery selecting the IDs of every media item matching a search,
+// ignoring its pagination and ordering, for use in "... IN (subquery)" aggregates
+func matchingMediaSQL(query *models.SearchQuery) (string, []interface{}, error) {
+	clauses, args, err := buildSearchConditions(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	subquery := "SELECT m.id FROM media m"
+	if len(clauses) > 0 {
+		subquery += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	return subquery, args, nil
+}
+
+// compileQueryNode compiles a boolean search expression into a single SQL condition.
+// Wildcards expand to at most maxWildcardTags tags if capWildcards is set, except under a negation.
+func compileQueryNode(node *models.QueryNode, capWildcards bool) (string, []interface{}, error) {
+	switch node.Kind {
+	case models.QueryNodeTag:
+		// Aliased names search for their consequent instead
+		return `m.id IN (
+			SELECT mt.media_id FROM media_tags mt
+			JOIN tags t ON mt.tag_id = t.id
+			WHERE t.name = ` + aliasLookupSQL + `
+		)`, []interface{}{node.Value, node.Value}, nil
+
+	case models.QueryNodeWildcard:
+		// Each pattern must match at least one of the media's tags
+		if !capWildcards {
+			return `m.id IN (
+				SELECT media_id FROM media_tags
+				WHERE tag_id IN (` + wildcardTagsSubquery + `)
+			)`, []interface{}{globToLike(node.Value)}, nil
+		}
+		return `m.id IN (
+			SELECT media_id FROM media_tags
+			WHERE tag_id IN (` + wildcardTagsSubquery + ` ORDER BY usage_count DESC LIMIT ?)
+		)`, []interface{}{globToLike(node.Value), maxWildcardTags}, nil
+
+	case models.QueryNodeAnd, models.QueryNodeOr:
+		if len(node.Children) == 0 {
+			return "", nil, fmt.Errorf("%w: empty expression group", ErrInvalidInput)
+		}
+
+		var parts []string
+		var args []interface{}
+		for _, child := range node.Children {
+			part, childArgs, err := compileQueryNode(child, capWildcards)
+			if err != nil {
+				return "", nil, err
+			}
+			parts = append(parts, part)
+			args = append(args, childArgs...)
+		}
+
+		op := " AND "
+		if node.Kind == models.QueryNodeOr {
+			op = " OR "
+		}
+		return "(" + strings.Join(parts, op) + ")", args, nil
+
+	case models.QueryNodeNot:
+		if len(node.Children) != 1 {
+			return "", nil, fmt.Errorf("%w: negation must have exactly one operand", ErrInvalidInput)
+		}
+		part, args, err := compileQueryNode(node.Children[0], false)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + part + ")", args, nil
+
+	case models.QueryNodeFilter:
+		if node.Filter == nil {
+			return "", nil, fmt.Errorf("%w: filter node without conditions", ErrInvalidInput)
+		}
+		clauses, args, err := buildSearchConditions(node.Filter)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(clauses) == 0 {
+			return "1", nil, nil
+		}
+		return "(" + strings.Join(clauses, " AND ") + ")", args, nil
+
+	default:
+		return "", nil, fmt.Errorf("%w: unknown expression node kind %d", ErrInvalidInput, node.Kind)
+	}
+}
+
+// tagCountColumns maps tag categories to their denormalized per-media count columns
+var tagCountColumns = map[models.TagCategory]string{
+	models.TagCategoryGeneral:   "m.tag_count_general",
+	models.TagCategoryArtist:    "m.tag_count_artist",
+	models.TagCategoryCopyright: "m.tag_count_copyright",
+	models.TagCategoryCharacter: "m.tag_count_character",
+	models.TagCategoryMetadata:  "m.tag_count_metadata",
+}
+
+// inClause builds "column IN (?, ...)" for a list of values
+func inClause[T any](column string, values []T) (string, []interface{}) {
+	placeholders := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		placeholders[i] = "?"
+		args[i] = v
+	}
+	return fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")), args
+}
+
+// filterConditions compiles the /filter:value conditions of a query
+func filterConditions(query *models.SearchQuery) ([]string, []interface{}, error) {
+	var clauses []string
+	var args []interface{}
+
+	if query.IsFavorite != nil {
+		var fav int
+		if *query.IsFavorite {
+			fav = 1
+		}
+		clauses = append(clauses, "m.is_favorite = ?")
+		args = append(args, fav)
+	}
+
+	if len(query.Rating) > 0 {
+		var ratingPlaceholders []string
+		for _, rating := range query.Rating {
+			ratingPlaceholders = append(ratingPlaceholders, "?")
+			args = append(args, rating)
+		}
+		clauses = append(clauses, fmt.Sprintf("m.rating IN (%s)", strings.Join(ratingPlaceholders, ", ")))
+	}
+
+	if len(query.AllowedRatings) > 0 {
+		var allowedPlaceholders []string
+		for _, rating := range query.AllowedRatings {
+			allowedPlaceholders = append(allowedPlaceholders, "?")
+			args = append(args, rating)
+		}
+		clauses = append(clauses, fmt.Sprintf("m.rating IN (%s)", strings.Join(allowedPlaceholders, ", ")))
+	}
+
+	if len(query.MediaTypes) > 0 {
+		var typePlaceholders []string
+		for _, mediaType := range query.MediaTypes {
+			typePlaceholders = append(typePlaceholders, "?")
+			args = append(args, mediaType)
+		}
+		clauses = append(clauses, fmt.Sprintf("m.media_type IN (%s)", strings.Join(typePlaceholders, ", ")))
+	}
+
+	if len(query.Extensions) > 0 {
+		clause, values := inClause("LOWER(m.file_ext)", query.Extensions)
+		clauses = append(clauses, clause)
+		args = append(args, values...)
+	}
+	if len(query.MD5s) > 0 {
+		clause, values := inClause("m.md5", query.MD5s)
+		clauses = append(clauses, clause)
+		args = append(args, values...)
+	}
+	if len(query.Codecs) > 0 {
+		clause, values := inClause("LOWER(m.codec)", query.Codecs)
+		clauses = append(clauses, clause)
+		args = append(args, values...)
+	}
+	if len(query.MimeTypes) > 0 {
+		clause, values := inClause("LOWER(m.mime_type)", query.MimeTypes)
+		clauses = append(clauses, clause)
+		args = append(args, values...)
+	}
+
+	if query.MinID != nil {
+		clauses = append(clauses, "m.id >= ?")
+		args = append(args, *query.MinID)
+	}
+	if query.MaxID != nil {
+		clauses = append(clauses, "m.id <= ?")
+		args = append(args, *query.MaxID)
+	}
+
+	if query.MinWidth != nil {
+		clauses = append(clauses, "m.width >= ?")
+		args = append(args, *query.MinWidth)
+	}
+	if query.MaxWidth != nil {
+		clauses = append(clauses, "m.width <= ?")
+		args = append(args, *query.MaxWidth)
+	}
+	if query.MinHeight != nil {
+		clauses = append(clauses, "m.height >= ?")
+		args = append(args, *query.MinHeight)
+	}
+	if query.MaxHeight != nil {
+		clauses = append(clauses, "m.height <= ?")
+		args = append(args, *query.MaxHeight)
+	}
+
+	if query.MinFileSize != nil {
+		clauses = append(clauses, "m.file_size >= ?")
+		args = append(args, *query.MinFileSize)
+	}
+	if query.MaxFileSize != nil {
+		clauses = append(clauses, "m.file_size <= ?")
+		args = append(args, *query.MaxFileSize)
+	}
+
+	if query.MinDuration != nil {
+		clauses = append(clauses, "m.duration >= ?")
+		args = append(args, *query.MinDuration)
+	}
+	if query.MaxDuration != nil {
+		clauses = append(clauses, "m.duration <= ?")
+		args = append(args, *query.MaxDuration)
+	}
+
+	if query.MinRatio != nil {
+		clauses = append(clauses, "m.height > 0 AND CAST(m.width AS REAL) / m.height >= ?")
+		args = append(args, *query.MinRatio)
+	}
+	if query.MaxRatio != nil {
+		clauses = append(clauses, "m.height > 0 AND CAST(m.width AS REAL) / m.height <= ?")
+		args = append(args, *query.MaxRatio)
+	}
+
+	if query.MinMegapixels != nil {
+		clauses = append(clauses, "m.width * m.height >= ?")
+		args = append(args, *query.MinMegapixels*1e6)
+	}
+	if query.MaxMegapixels != nil {
+		clauses = append(clauses, "m.width * m.height <= ?")
+		args = append(args, *query.MaxMegapixels*1e6)
+	}
+
+	for _, tc := range query.TagCounts {
+		column := "m.tag_count"
+		if tc.Category != nil {
+			c, ok := tagCountColumns[*tc.Category]
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: unknown tag category %d", ErrInvalidInput, *tc.Category)
+			}
+			column = c
+		}
+		if tc.Min != nil {
+			clauses = append(clauses, column+" >= ?")
+			args = append(args, *tc.Min)
+		}
+		if tc.Max != nil {
+			clauses = append(clauses, column+" <= ?")
+			args = append(args, *tc.Max)
+		}
+	}
+
+	if query.HasParent != nil {
+		if *query.HasParent {
+			clauses = append(clauses, "m.parent_id IS NOT NULL")
+		} else {
+			clauses = append(clauses, "m.parent_id IS NULL")
+		}
+	}
+
+	if query.HasChildren != nil {
+		clauses = append(clauses, "m.has_children = ?")
+		var hasChildren int
+		if *query.HasChildren {
+			hasChildren = 1
+		}
+		args = append(args, hasChildren)
+	}
+
+	if query.ParentID != nil {
+		clauses = append(clauses, "m.parent_id = ?")
+		args = append(args, *query.ParentID)
+	}
+
+	if query.CreatedAfter != nil {
+		clauses = append(clauses, "m.created_at >= ?")
+		args = append(args, query.CreatedAfter.Unix())
+	}
+	if query.CreatedBefore != nil {
+		clauses = append(clauses, "m.created_at <= ?")
+		args = append(args, query.CreatedBefore.Unix())
+	}
+
+	if query.ViewedAfter != nil {
+		clauses = append(clauses, "m.last_viewed_at >= ?")
+		args = append(args, query.ViewedAfter.Unix())
+	}
+	if query.ViewedBefore != nil {
+		clauses = append(clauses, "m.last_viewed_at <= ?")
+		args = append(args, query.ViewedBefore.Unix())
+	}
+
+	if query.Viewed != nil {
+		if *query.Viewed {
+			clauses = append(clauses, "m.last_viewed_at IS NOT NULL")
+		} else {
+			clauses = append(clauses, "m.last_viewed_at IS NULL")
+		}
+	}
+
+	return clauses, args, nil
+}
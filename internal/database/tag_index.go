@@ -0,0 +1,527 @@
+package database
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"mybooru/internal/editdist"
+	"mybooru/internal/models"
+)
+
+// Match tiers for tag suggestions, best first
+const (
+	matchPrefix     = iota // The tag name or one of its aliases starts with the pattern
+	matchWordPrefix        // A later word of the tag name (after an '_') starts with the pattern
+	matchFuzzy             // The tag name starts with something close to the pattern
+)
+
+// minFuzzyPatternLength is the shortest pattern that gets fuzzy matches; shorter patterns match too much
+const minFuzzyPatternLength = 4
+
+// tagEntry is the indexed form of a tag
+type tagEntry struct {
+	id       int64
+	name     string
+	lower    string
+	category models.TagCategory
+	usage    int
+	deleted  bool
+}
+
+// indexKey is a searchable string pointing back at a tag: its full name, a word within it or an alias
+type indexKey struct {
+	key   string
+	entry *tagEntry
+	tier  int
+	alias string // The alias name for alias keys
+}
+
+// tagIndex is an in-memory index of tag names for autocompletion.
+//
+// It is kept current through SQLite hooks: every change to the tags or tag_aliases tables is
+// recorded per connection and handed to the index once the transaction has committed, after which
+// the next search reloads just the changed rows. Usage count changes update entries in place,
+// new tags are inserted into the sorted keys, and deletes or renames rebuild the derived structures.
+type tagIndex struct {
+	mu      sync.Mutex
+	loaded  bool
+	byID    map[int64]*tagEntry
+	keys    []indexKey // Sorted by key, for prefix range scans
+	aliases []models.TagAlias
+
+	changesMu    sync.Mutex
+	changedTags  map[int64]bool
+	aliasesStale bool
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{changedTags: make(map[int64]bool)}
+}
+
+// connectionHooks tracks the tag changes made through one connection.
+// Changes are only handed to the index once their commit has returned and is visible to other
+// connections, so a concurrent refresh can't reload the old rows and consider them current.
+// Rolled back writes never reach the index.
+type connectionHooks struct {
+	idx *tagIndex
+
+	pendingTags    []int64 // Changed in the open transaction
+	pendingAliases bool
+
+	committedTags    []int64 // Committed but not yet published
+	committedAliases bool
+}
+
+func (idx *tagIndex) connectionHooks() *connectionHooks {
+	return &connectionHooks{idx: idx}
+}
+
+func (h *connectionHooks) update(op int, dbName, table string, rowid int64) {
+	switch table {
+	case "tags":
+		h.pendingTags = append(h.pendingTags, rowid)
+	case "tag_aliases":
+		h.pendingAliases = true
+	}
+}
+
+// commit runs inside SQLite just before the commit completes, so it only sets the changes aside
+func (h *connectionHooks) commit() int {
+	h.committedTags = append(h.committedTags, h.pendingTags...)
+	h.committedAliases = h.committedAliases || h.pendingAliases
+	h.pendingTags = h.pendingTags[:0]
+	h.pendingAliases = false
+	return 0
+}
+
+func (h *connectionHooks) rollback() {
+	h.pendingTags = h.pendingTags[:0]
+	h.pendingAliases = false
+}
+
+// publish hands committed changes to the index. It is called after each statement or transaction
+// commit on the connection has returned.
+func (h *connectionHooks) publish() {
+	if len(h.committedTags) == 0 && !h.committedAliases {
+		return
+	}
+
+	h.idx.changesMu.Lock()
+	for _, id := range h.committedTags {
+		h.idx.changedTags[id] = true
+	}
+	h.idx.aliasesStale = h.idx.aliasesStale || h.committedAliases
+	h.idx.changesMu.Unlock()
+
+	h.committedTags = h.committedTags[:0]
+	h.committedAliases = false
+}
+
+// refresh loads the index on first use and afterwards applies the changes committed since the last search.
+// Must be called with idx.mu held.
+func (idx *tagIndex) refresh(db *sql.DB) error {
+	if !idx.loaded {
+		// Anything committed from here on is already covered by the full load
+		idx.changesMu.Lock()
+		idx.changedTags = make(map[int64]bool)
+		idx.aliasesStale = false
+		idx.changesMu.Unlock()
+
+		if err := idx.load(db); err != nil {
+			return err
+		}
+		idx.loaded = true
+		return nil
+	}
+
+	idx.changesMu.Lock()
+	changed := idx.changedTags
+	aliasesStale := idx.aliasesStale
+	idx.changedTags = make(map[int64]bool)
+	idx.aliasesStale = false
+	idx.changesMu.Unlock()
+
+	if len(changed) == 0 && !aliasesStale {
+		return nil
+	}
+
+	rebuild := aliasesStale
+	if aliasesStale {
+		aliases, err := loadAliases(db)
+		if err != nil {
+			return err
+		}
+		idx.aliases = aliases
+	}
+
+	for id := range changed {
+		needsRebuild, err := idx.reloadTag(db, id)
+		if err != nil {
+			return err
+		}
+		rebuild = rebuild || needsRebuild
+	}
+
+	if rebuild {
+		idx.rebuild()
+	}
+	return nil
+}
+
+// load reads every tag and alias and builds the index from scratch
+func (idx *tagIndex) load(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, name, category, usage_count FROM tags")
+	if err != nil {
+		return WrapQueryError("tags", err)
+	}
+	defer rows.Close()
+
+	idx.byID = make(map[int64]*tagEntry)
+	for rows.Next() {
+		e := &tagEntry{}
+		if err := rows.Scan(&e.id, &e.name, &e.category, &e.usage); err != nil {
+			return WrapScanError("tag", err)
+		}
+		e.lower = strings.ToLower(e.name)
+		idx.byID[e.id] = e
+	}
+	if err = rows.Err(); err != nil {
+		return WrapIterationError("tag", err)
+	}
+
+	idx.aliases, err = loadAliases(db)
+	if err != nil {
+		return err
+	}
+
+	idx.rebuild()
+	return nil
+}
+
+func loadAliases(db *sql.DB) ([]models.TagAlias, error) {
+	rows, err := db.Query("SELECT antecedent_name, consequent_name FROM tag_aliases")
+	if err != nil {
+		return nil, WrapQueryError("tag aliases", err)
+	}
+	defer rows.Close()
+
+	var aliases []models.TagAlias
+	for rows.Next() {
+		var a models.TagAlias
+		if err := rows.Scan(&a.AntecedentName, &a.ConsequentName); err != nil {
+			return nil, WrapScanError("tag alias", err)
+		}
+		aliases = append(aliases, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("tag alias", err)
+	}
+
+	return aliases, nil
+}
+
+// reloadTag refreshes a single tag from the database. It returns true if the sorted keys
+// could no longer be patched in place and need a rebuild.
+func (idx *tagIndex) reloadTag(db *sql.DB, id int64) (bool, error) {
+	e := &tagEntry{id: id}
+	err := db.QueryRow("SELECT name, category, usage_count FROM tags WHERE id = ?", id).Scan(&e.name, &e.category, &e.usage)
+	if err == sql.ErrNoRows {
+		if old, ok := idx.byID[id]; ok {
+			old.deleted = true
+			delete(idx.byID, id)
+			return true, nil
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, WrapGetByIDError("tag", err)
+	}
+	e.lower = strings.ToLower(e.name)
+
+	old, ok := idx.byID[id]
+	if !ok {
+		idx.byID[id] = e
+		idx.insert(e)
+		return false, nil
+	}
+	if old.name != e.name {
+		old.deleted = true
+		idx.byID[id] = e
+		return true, nil
+	}
+
+	// Usage counts change with every tagging, so update those without touching the structure
+	old.category = e.category
+	old.usage = e.usage
+	return false, nil
+}
+
+// entryKeys returns the name and word keys of a tag
+func entryKeys(e *tagEntry) []indexKey {
+	keys := []indexKey{{key: e.lower, entry: e, tier: matchPrefix}}
+	for i := 0; i < len(e.lower); i++ {
+		if e.lower[i] == '_' && i+1 < len(e.lower) && e.lower[i+1] != '_' {
+			keys = append(keys, indexKey{key: e.lower[i+1:], entry: e, tier: matchWordPrefix})
+		}
+	}
+	return keys
+}
+
+// insert adds a new tag to the sorted keys without a full rebuild
+func (idx *tagIndex) insert(e *tagEntry) {
+	for _, k := range entryKeys(e) {
+		idx.insertKey(k)
+	}
+	for _, a := range idx.aliases {
+		if strings.EqualFold(a.ConsequentName, e.name) {
+			idx.insertKey(indexKey{key: strings.ToLower(a.AntecedentName), entry: e, tier: matchPrefix, alias: a.AntecedentName})
+		}
+	}
+}
+
+func (idx *tagIndex) insertKey(k indexKey) {
+	i := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i].key >= k.key })
+	idx.keys = append(idx.keys, indexKey{})
+	copy(idx.keys[i+1:], idx.keys[i:])
+	idx.keys[i] = k
+}
+
+// rebuild recomputes the sorted keys from the current tags and aliases
+func (idx *tagIndex) rebuild() {
+	keys := make([]indexKey, 0, len(idx.byID)*2)
+	byName := make(map[string]*tagEntry, len(idx.byID))
+
+	for _, e := range idx.byID {
+		keys = append(keys, entryKeys(e)...)
+		byName[e.lower] = e
+	}
+
+	for _, a := range idx.aliases {
+		if e, ok := byName[strings.ToLower(a.ConsequentName)]; ok {
+			keys = append(keys, indexKey{key: strings.ToLower(a.AntecedentName), entry: e, tier: matchPrefix, alias: a.AntecedentName})
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key < keys[j].key })
+	idx.keys = keys
+}
+
+// candidate is a tag matched at some tier, before it becomes a suggestion
+type candidate struct {
+	entry *tagEntry
+	tier  int
+	alias string
+}
+
+// ranksAbove reports whether a is a better suggestion than b
+func (a candidate) ranksAbove(b candidate) bool {
+	if a.tier != b.tier {
+		return a.tier < b.tier
+	}
+	if a.entry.usage != b.entry.usage {
+		return a.entry.usage > b.entry.usage
+	}
+	return a.entry.lower < b.entry.lower
+}
+
+// suggestionCollector keeps the best limit candidates seen so far, one per tag, best first
+type suggestionCollector struct {
+	limit int
+	best  []candidate
+}
+
+func (c *suggestionCollector) add(e *tagEntry, tier int, alias string) {
+	if e.deleted {
+		return
+	}
+	cand := candidate{entry: e, tier: tier, alias: alias}
+
+	// Most candidates of a broad pattern lose to the current worst, so reject those first.
+	// If the tag is already collected at a worse tier, that entry ranks below cand, so a
+	// rejected cand can't be hiding an improvement.
+	if len(c.best) == c.limit && !cand.ranksAbove(c.best[len(c.best)-1]) {
+		return
+	}
+
+	for i, b := range c.best {
+		if b.entry == e {
+			if !cand.ranksAbove(b) {
+				return
+			}
+			c.best = append(c.best[:i], c.best[i+1:]...)
+			break
+		}
+	}
+	if len(c.best) == c.limit {
+		c.best = c.best[:len(c.best)-1]
+	}
+
+	i := sort.Search(len(c.best), func(i int) bool { return cand.ranksAbove(c.best[i]) })
+	c.best = append(c.best, candidate{})
+	copy(c.best[i+1:], c.best[i:])
+	c.best[i] = cand
+}
+
+func (c *suggestionCollector) suggestions() []*models.TagSuggestion {
+	suggestions := make([]*models.TagSuggestion, 0, len(c.best))
+	for _, b := range c.best {
+		suggestions = append(suggestions, &models.TagSuggestion{
+			ID:         b.entry.id,
+			Name:       b.entry.name,
+			Category:   b.entry.category,
+			UsageCount: b.entry.usage,
+			Alias:      b.alias,
+		})
+	}
+	return suggestions
+}
+
+// prefixEnd returns the index of the first key at or after start that doesn't begin with prefix
+func (idx *tagIndex) prefixEnd(start int, prefix string) int {
+	return start + sort.Search(len(idx.keys)-start, func(i int) bool {
+		k := idx.keys[start+i].key
+		return k > prefix && !strings.HasPrefix(k, prefix)
+	})
+}
+
+// search returns up to limit tags matching pattern. Must be called with idx.mu held.
+func (idx *tagIndex) search(pattern string, limit int) []*models.TagSuggestion {
+	c := &suggestionCollector{limit: limit}
+
+	start := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i].key >= pattern })
+	end := idx.prefixEnd(start, pattern)
+	for _, k := range idx.keys[start:end] {
+		c.add(k.entry, k.tier, k.alias)
+	}
+
+	if len(c.best) < limit && utf8.RuneCountInString(pattern) >= minFuzzyPatternLength {
+		idx.fuzzy(pattern, c)
+	}
+
+	return c.suggestions()
+}
+
+// fuzzy adds tags whose names start with something within a small edit distance of pattern.
+//
+// Typos in the first character are rare, so only names sharing it are considered. The edit
+// distance is computed one row per rune of the name, and since the keys are sorted, rows for
+// the prefix a key shares with the previous one are reused. Once a prefix is settled, either
+// because it is too far from the pattern to ever match or because it is as long as a match can
+// be, every key that starts with it gets the same answer and is handled without further work.
+func (idx *tagIndex) fuzzy(pattern string, c *suggestionCollector) {
+	p := []rune(pattern)
+	limit := 1
+	if len(p) >= 6 {
+		limit = 2
+	}
+
+	// Prefixes more than limit runes longer than the pattern can't be within limit
+	maxDepth := len(p) + limit
+	rows := make([][]int, maxDepth+1)
+	for d := range rows {
+		rows[d] = make([]int, len(p)+1)
+	}
+	editdist.FirstRow(rows[0])
+	name := make([]rune, maxDepth+1) // name[d] is the d-th rune of the current key, 1-based
+	offsets := make([]int, maxDepth+1)
+	best := make([]int, maxDepth+1) // Smallest distance between the pattern and any prefix up to depth d
+	best[0] = len(p)
+
+	first := string(p[0])
+	i := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i].key >= first })
+	end := idx.prefixEnd(i, first)
+
+	prev := ""
+	depth := 0
+	for i < end {
+		key := idx.keys[i].key
+
+		// Resume from the deepest row that only depends on the prefix shared with the previous key
+		shared := commonPrefixLength(prev, key)
+		d := 0
+		for d < depth && offsets[d+1] <= shared {
+			d++
+		}
+
+		settled := false
+		for !settled && offsets[d] < len(key) {
+			r, size := utf8.DecodeRuneInString(key[offsets[d]:])
+			d++
+			name[d] = r
+			offsets[d] = offsets[d-1] + size
+
+			var aboveAbove []int
+			if d > 1 {
+				aboveAbove = rows[d-2]
+			}
+			rowMin := editdist.Row(p, rows[d], rows[d-1], aboveAbove, d, r, name[d-1])
+			best[d] = min(best[d-1], rows[d][len(p)])
+			settled = rowMin > limit || d == maxDepth
+		}
+		prev, depth = key, d
+
+		next := i + 1
+		if settled {
+			next = idx.prefixEnd(i, key[:offsets[d]])
+		}
+		if best[d] <= limit {
+			for _, k := range idx.keys[i:next] {
+				if k.tier == matchPrefix && k.alias == "" {
+					c.add(k.entry, matchFuzzy, "")
+				}
+			}
+		}
+		i = next
+	}
+}
+
+// known reports whether name is the name of a tag or an alias of one. Must be called with idx.mu held.
+func (idx *tagIndex) known(name string) bool {
+	i := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i].key >= name })
+	for ; i < len(idx.keys) && idx.keys[i].key == name; i++ {
+		if k := idx.keys[i]; k.tier == matchPrefix && !k.entry.deleted {
+			return true
+		}
+	}
+	return false
+}
+
+// corrections returns up to limit tags whose name or alias is within a small edit distance of the
+// whole of name, closest first and then by usage count. Like fuzzy, it only considers keys sharing
+// the first rune. Must be called with idx.mu held.
+func (idx *tagIndex) corrections(name string, limit int) []*models.TagSuggestion {
+	p := []rune(name)
+	maxDistance := 1
+	if len(p) >= 6 {
+		maxDistance = 2
+	}
+
+	// The collector ranks by tier first, so the edit distance stands in for it
+	c := &suggestionCollector{limit: limit}
+	first := string(p[0])
+	start := sort.Search(len(idx.keys), func(i int) bool { return idx.keys[i].key >= first })
+	for _, k := range idx.keys[start:idx.prefixEnd(start, first)] {
+		if k.tier != matchPrefix {
+			continue
+		}
+		if d := editdist.Distance(p, []rune(k.key), maxDistance); d <= maxDistance {
+			c.add(k.entry, d, k.alias)
+		}
+	}
+
+	return c.suggestions()
+}
+
+// commonPrefixLength returns the length in bytes of the longest common prefix of a and b
+func commonPrefixLength(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"mybooru/internal/models"
+)
+
+func suggestionNames(t *testing.T, db *DB, pattern string, limit int) []string {
+	t.Helper()
+
+	suggestions, err := db.SearchTags(pattern, limit)
+	AssertNoError(t, err, "SearchTags failed")
+	return formatSuggestions(suggestions)
+}
+
+// formatSuggestions lists suggested tag names, with the alias that matched as "alias->name"
+func formatSuggestions(suggestions []*models.TagSuggestion) []string {
+	names := make([]string, 0, len(suggestions))
+	for _, s := range suggestions {
+		if s.Alias != "" {
+			names = append(names, s.Alias+"->"+s.Name)
+		} else {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+func TestSuggestTagCorrections(t *testing.T) {
+	db := SetupTestDB(t)
+
+	createTestMedia(t, db, "long_hair", "blue_eyes", "blonde_hair")
+	createTestMedia(t, db, "long_hair", "blue_sky", "cat")
+	createTestMedia(t, db, "long_hair", "blue_eyes", "blue_hair_ribbon")
+	_, err := db.CreateTagAlias("kitty", "cat", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	tests := []struct {
+		term string
+		want []string
+	}{
+		{term: "lnog_hair", want: []string{"long_hair"}},
+		{term: "blue_eye", want: []string{"blue_eyes"}},
+		{term: "blue_ski", want: []string{"blue_sky"}},
+		{term: "BLUE_EYSE", want: []string{"blue_eyes"}},
+		{term: "kity", want: []string{"kitty->cat"}},
+		{term: "cta", want: []string{"cat"}},
+		{term: "blue_hai", want: []string{}},
+		{term: "zzz", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			suggestions, err := db.SuggestTagCorrections(tt.term, 3)
+			AssertNoError(t, err, "SuggestTagCorrections failed")
+			AssertEqual(t, formatSuggestions(suggestions), tt.want, "corrections mismatch")
+		})
+	}
+
+	for _, known := range []string{"long_hair", "Blue_Eyes", "kitty"} {
+		suggestions, err := db.SuggestTagCorrections(known, 3)
+		AssertNoError(t, err, "SuggestTagCorrections failed")
+		if suggestions != nil {
+			t.Errorf("known tag %s should get no corrections, got %v", known, formatSuggestions(suggestions))
+		}
+	}
+}
+
+func TestSearchTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	createTestMedia(t, db, "long_hair", "blue_eyes", "blonde_hair")
+	createTestMedia(t, db, "long_hair", "blue_sky")
+	createTestMedia(t, db, "long_hair", "blue_eyes", "hair_ribbon")
+	_, err := db.CreateTagAlias("blue_hair", "long_hair", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	tests := []struct {
+		pattern string
+		limit   int
+		want    []string
+	}{
+		{pattern: "blu", limit: 10, want: []string{"blue_hair->long_hair", "blue_eyes", "blue_sky"}},
+		{pattern: "BLUE_E", limit: 10, want: []string{"blue_eyes", "blue_sky"}},
+		{pattern: "hair", limit: 10, want: []string{"hair_ribbon", "long_hair", "blonde_hair"}},
+		{pattern: "hair", limit: 2, want: []string{"hair_ribbon", "long_hair"}},
+		{pattern: "lnog_h", limit: 10, want: []string{"long_hair"}},
+		{pattern: "bleu", limit: 10, want: []string{"blue_eyes", "blue_sky"}},
+		{pattern: "xyz", limit: 10, want: []string{}},
+		{pattern: "", limit: 10, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			AssertEqual(t, suggestionNames(t, db, tt.pattern, tt.limit), tt.want, "suggestions mismatch")
+		})
+	}
+
+	suggestions, err := db.SearchTags("long", 1)
+	AssertNoError(t, err, "SearchTags failed")
+	AssertEqual(t, suggestions[0].UsageCount, 3, "usage count")
+	AssertEqual(t, suggestions[0].Category, models.TagCategoryGeneral, "category")
+}
+
+func TestSearchTagsStaysCurrent(t *testing.T) {
+	db := SetupTestDB(t)
+
+	cat := createTestMedia(t, db, "cat")
+	AssertEqual(t, suggestionNames(t, db, "ca", 10), []string{"cat"}, "initial suggestions")
+
+	// New tags and usage changes are picked up
+	createTestMedia(t, db, "car", "cart")
+	createTestMedia(t, db, "car")
+	AssertEqual(t, suggestionNames(t, db, "ca", 10), []string{"car", "cart", "cat"}, "suggestions after tagging")
+
+	// Category changes are picked up
+	_, err := db.Exec("UPDATE tags SET category = ? WHERE name = 'cat'", models.TagCategoryCharacter)
+	AssertNoError(t, err, "failed to update category")
+	suggestions, err := db.SearchTags("cat", 1)
+	AssertNoError(t, err, "SearchTags failed")
+	AssertEqual(t, suggestions[0].Category, models.TagCategoryCharacter, "updated category")
+
+	// Deleted tags disappear
+	cart, err := db.GetTagByName("cart")
+	AssertNoError(t, err, "GetTagByName failed")
+	AssertNoError(t, db.DeleteTag(cart.ID), "DeleteTag failed")
+	AssertEqual(t, suggestionNames(t, db, "ca", 10), []string{"car", "cat"}, "suggestions after delete")
+
+	// Renamed tags move
+	_, err = db.Exec("UPDATE tags SET name = 'kitty' WHERE name = 'cat'")
+	AssertNoError(t, err, "failed to rename tag")
+	AssertEqual(t, suggestionNames(t, db, "ca", 10), []string{"car"}, "suggestions after rename")
+	AssertEqual(t, suggestionNames(t, db, "kit", 10), []string{"kitty"}, "renamed tag")
+
+	// Aliases are picked up, including for tags created after the alias
+	_, err = db.CreateTagAlias("automobile", "vehicle", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+	AssertEqual(t, suggestionNames(t, db, "auto", 10), []string{}, "alias without a tag")
+	AssertNoError(t, db.AddTagsToMediaTx(cat, []models.CreateTagInput{{Name: "vehicle"}}), "AddTagsToMediaTx failed")
+	AssertEqual(t, suggestionNames(t, db, "auto", 10), []string{"automobile->vehicle"}, "alias after its tag is created")
+
+	// Rolled back changes are ignored
+	tx, err := db.Begin()
+	AssertNoError(t, err, "Begin failed")
+	_, err = tx.Exec("INSERT INTO tags (name, category, created_at) VALUES ('carrot', 0, 0)")
+	AssertNoError(t, err, "insert failed")
+	AssertNoError(t, tx.Rollback(), "Rollback failed")
+	AssertEqual(t, suggestionNames(t, db, "car", 10), []string{"car"}, "rolled back tag")
+}
+
+func TestTagIndexPublishesAfterCommit(t *testing.T) {
+	idx := newTagIndex()
+	hooks := idx.connectionHooks()
+
+	changed := func() int {
+		idx.changesMu.Lock()
+		defer idx.changesMu.Unlock()
+		return len(idx.changedTags)
+	}
+
+	hooks.update(0, "main", "tags", 1)
+	hooks.rollback()
+	hooks.publish()
+	AssertEqual(t, changed(), 0, "rolled back changes should not be published")
+
+	// The commit hook runs before the commit is visible to other connections, so a refresh
+	// in between must not see the change yet
+	hooks.update(0, "main", "tags", 2)
+	hooks.commit()
+	AssertEqual(t, changed(), 0, "changes should not be published from the commit hook")
+
+	hooks.publish()
+	AssertEqual(t, changed(), 1, "committed changes should be published")
+}
+
+func TestSearchTagsConcurrentWrites(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.db"))
+	AssertNoError(t, err, "InitDB failed")
+	t.Cleanup(func() { db.Close() })
+
+	const writers, tagsPerWriter = 4, 25
+
+	var wg, searcher sync.WaitGroup
+	done := make(chan struct{})
+	searcher.Add(1)
+	go func() {
+		defer searcher.Done()
+		// Keep refreshing the index while tags are being committed
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if _, err := db.SearchTags("tag", 1); err != nil {
+					t.Errorf("SearchTags failed: %v", err)
+					return
+				}
+			}
+		}
+	}()
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < tagsPerWriter; i++ {
+				_, err := db.CreateTag(&models.CreateTagInput{Name: fmt.Sprintf("tag_%d_%d", w, i)})
+				if err != nil {
+					t.Errorf("CreateTag failed: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(done)
+	searcher.Wait()
+
+	suggestions, err := db.SearchTags("tag", writers*tagsPerWriter+1)
+	AssertNoError(t, err, "SearchTags failed")
+	AssertEqual(t, len(suggestions), writers*tagsPerWriter, "every committed tag should be indexed")
+}
+
+func BenchmarkSearchTags(b *testing.B) {
+	db := SetupTestDB(b)
+
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	words := []string{"long", "short", "blue", "red", "hair", "eyes", "dress", "sky", "cat", "girl"}
+	for i := 0; i < 100000; i++ {
+		name := fmt.Sprintf("%s_%s_%d", words[i%len(words)], words[(i/len(words))%len(words)], i)
+		if _, err := tx.Exec("INSERT INTO tags (name, category, usage_count, created_at) VALUES (?, ?, ?, 0)", name, i%5, i%997); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+
+	// Load the index before timing
+	if _, err := db.SearchTags("warmup", 10); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, pattern := range []string{"l", "blu", "hair_e", "red_sky_12", "bleu_h", "zzz"} {
+		b.Run(pattern, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.SearchTags(pattern, 10); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
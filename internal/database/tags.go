@@ -105,6 +105,242 @@ func (db *DB) DeleteTag(id int64) error {
 	return nil
 }
 
+// RenameTag gives a tag a new name, keeping its media, implications and aliases.
+// Renaming to the name of another tag is rejected; use MergeTags to combine them instead.
+func (db *DB) RenameTag(id int64, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("%w: tag name cannot be empty", ErrInvalidInput)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRow("SELECT name FROM tags WHERE id = ?", id).Scan(&oldName)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return WrapGetByIDError("tag", err)
+	}
+
+	// Differences in case alone are allowed, since they don't collide with the tag itself
+	var existing string
+	err = tx.QueryRow("SELECT name FROM tags WHERE name = ? COLLATE NOCASE AND id != ?", name, id).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf("%w: tag %s already exists", ErrConstraintViolation, existing)
+	}
+	if err != sql.ErrNoRows {
+		return WrapGetByNameError("tag", err)
+	}
+
+	var consequent string
+	err = tx.QueryRow("SELECT consequent_name FROM tag_aliases WHERE antecedent_name = ? COLLATE NOCASE", name).Scan(&consequent)
+	if err == nil {
+		return fmt.Errorf("%w: %s is an alias of %s", ErrConstraintViolation, name, consequent)
+	}
+	if err != sql.ErrNoRows {
+		return WrapQueryError("tag aliases", err)
+	}
+
+	if _, err := tx.Exec("UPDATE tags SET name = ? WHERE id = ?", name, id); err != nil {
+		return WrapUpdateError("tag", err)
+	}
+	if err := retargetTagAliasesTx(tx, oldName, name); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return WrapTransactionCommitError(err)
+	}
+
+	return nil
+}
+
+// MergeTags folds the tag fromID into the tag intoID and deletes fromID. Its media are retagged,
+// dropping duplicates on media that already had both tags, and its implications and aliases are
+// moved over, so the merged tag keeps intoID's name and category. The usage count of intoID and
+// the tag counts of its media are recounted afterwards. If leaveAlias is set, the old name becomes
+// an alias of intoID so that tagging or searching with it keeps working.
+func (db *DB) MergeTags(fromID, intoID int64, leaveAlias bool) error {
+	if fromID == intoID {
+		return fmt.Errorf("%w: a tag cannot be merged into itself", ErrInvalidInput)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	var fromName, intoName string
+	if err := tx.QueryRow("SELECT name FROM tags WHERE id = ?", fromID).Scan(&fromName); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return WrapGetByIDError("tag", err)
+	}
+	if err := tx.QueryRow("SELECT name FROM tags WHERE id = ?", intoID).Scan(&intoName); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return WrapGetByIDError("tag", err)
+	}
+
+	if err := moveMediaTagsTx(tx, fromID, intoID); err != nil {
+		return err
+	}
+	if err := moveTagImplicationsTx(tx, fromID, intoID); err != nil {
+		return err
+	}
+	if err := retargetTagAliasesTx(tx, fromName, intoName); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", fromID); err != nil {
+		return WrapDeleteError("tag", err)
+	}
+
+	if leaveAlias {
+		var existing string
+		err = tx.QueryRow("SELECT antecedent_name FROM tag_aliases WHERE antecedent_name = ? COLLATE NOCASE", intoName).Scan(&existing)
+		if err == nil {
+			return fmt.Errorf("%w: %s is already an alias and cannot be an alias target", ErrConstraintViolation, intoName)
+		}
+		if err != sql.ErrNoRows {
+			return WrapQueryError("tag aliases", err)
+		}
+
+		_, err = tx.Exec("INSERT INTO tag_aliases (antecedent_name, consequent_name, created_at) VALUES (?, ?, ?)",
+			fromName, intoName, time.Now().Unix())
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				return fmt.Errorf("%w: alias for %s already exists", ErrConstraintViolation, fromName)
+			}
+			return WrapCreateError("tag alias", err)
+		}
+	}
+
+	if err := recountTagUsageTx(tx, intoID); err != nil {
+		return err
+	}
+	if err := recountTaggedMediaTx(tx, intoID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return WrapTransactionCommitError(err)
+	}
+
+	return nil
+}
+
+// SetTagCategory moves a tag to another category and recomputes the per-category tag counts
+// of every media item tagged with it
+func (db *DB) SetTagCategory(id int64, category models.TagCategory) error {
+	if category < models.TagCategoryGeneral || category > models.TagCategoryMetadata {
+		return fmt.Errorf("%w: unknown tag category %d", ErrInvalidInput, category)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE tags SET category = ? WHERE id = ?", category, id)
+	if err != nil {
+		return WrapUpdateError("tag", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return WrapRowsAffectedError(err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	if err := recountTaggedMediaTx(tx, id); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return WrapTransactionCommitError(err)
+	}
+
+	return nil
+}
+
+// promoteGeneralTagTx moves a general tag to category, recounting its media. Tags already in
+// another category are left alone, since a general tag is usually just one created without a prefix.
+func promoteGeneralTagTx(tx *sql.Tx, tagID int64, category models.TagCategory) error {
+	if category == models.TagCategoryGeneral {
+		return nil
+	}
+
+	result, err := tx.Exec("UPDATE tags SET category = ? WHERE id = ? AND category = ?", category, tagID, models.TagCategoryGeneral)
+	if err != nil {
+		return WrapUpdateError("tag", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return WrapRowsAffectedError(err)
+	}
+
+	if rowsAffected == 0 {
+		return nil
+	}
+
+	return recountTaggedMediaTx(tx, tagID)
+}
+
+// SearchTags suggests up to limit tags for a partially typed tag name. Tags whose name or alias
+// starts with the pattern rank first, then tags with a later word starting with it, then close
+// misspellings; each group is ordered by usage count. Results come from an in-memory index.
+func (db *DB) SearchTags(pattern string, limit int) ([]*models.TagSuggestion, error) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" || limit <= 0 {
+		return []*models.TagSuggestion{}, nil
+	}
+
+	db.tags.mu.Lock()
+	defer db.tags.mu.Unlock()
+
+	if err := db.tags.refresh(db.DB); err != nil {
+		return nil, WrapSearchError("tags", err)
+	}
+
+	return db.tags.search(pattern, limit), nil
+}
+
+// SuggestTagCorrections suggests up to limit known tags for a search term that isn't the name or
+// alias of any tag, closest by edit distance first. It returns nil if the term is already known.
+func (db *DB) SuggestTagCorrections(term string, limit int) ([]*models.TagSuggestion, error) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" || limit <= 0 {
+		return nil, nil
+	}
+
+	db.tags.mu.Lock()
+	defer db.tags.mu.Unlock()
+
+	if err := db.tags.refresh(db.DB); err != nil {
+		return nil, WrapSearchError("tags", err)
+	}
+
+	if db.tags.known(term) {
+		return nil, nil
+	}
+	return db.tags.corrections(term, limit), nil
+}
+
 // GetTagsByMediaID retrieves all tags for a given media item
 func (db *DB) GetTagsByMediaID(mediaID int64) ([]*models.Tag, error) {
 	query := `
@@ -138,41 +374,71 @@ func (db *DB) GetTagsByMediaID(mediaID int64) ([]*models.Tag, error) {
 	return tags, nil
 }
 
-// addTagsToMediaWithTx is the core logic for adding tags within an existing transaction
+// getOrCreateTagIDTx returns the ID of the named tag, creating it with the given category if needed
+func getOrCreateTagIDTx(tx *sql.Tx, name string, category models.TagCategory) (int64, error) {
+	var tagID int64
+	err := tx.QueryRow("SELECT id FROM tags WHERE name = ? COLLATE NOCASE", name).Scan(&tagID)
+	if err == nil {
+		return tagID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to query tag: %w", err)
+	}
+
+	result, err := tx.Exec("INSERT INTO tags (name, category, created_at) VALUES (?, ?, ?)",
+		name, category, time.Now().Unix())
+	if err != nil {
+		if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return 0, fmt.Errorf("failed to create tag %s: %w", name, err)
+		}
+		// Race condition: tag was created by another transaction, query again
+		err = tx.QueryRow("SELECT id FROM tags WHERE name = ? COLLATE NOCASE", name).Scan(&tagID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get tag ID after creation: %w", err)
+		}
+		return tagID, nil
+	}
+
+	tagID, err = result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	return tagID, nil
+}
+
+// addTagsToMediaWithTx is the core logic for adding tags within an existing transaction.
+// Aliased tag names are replaced by their consequents, and implied tags are added along with each tag.
+// An explicit category on an existing general tag recategorizes it.
 func addTagsToMediaWithTx(tx *sql.Tx, mediaID int64, tags []models.CreateTagInput) error {
 	now := time.Now().Unix()
 
 	for _, tag := range tags {
-		// Get or create tag
-		var tagID int64
-		err := tx.QueryRow("SELECT id FROM tags WHERE name = ? COLLATE NOCASE", tag.Name).Scan(&tagID)
-		if err == sql.ErrNoRows {
-			result, err := tx.Exec("INSERT INTO tags (name, category, created_at) VALUES (?, ?, ?)",
-				tag.Name, tag.Category, now)
-			if err != nil {
-				if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
-					return fmt.Errorf("failed to create tag %s: %w", tag.Name, err)
-				}
-				// Race condition: tag was created by another transaction, query again
-				err = tx.QueryRow("SELECT id FROM tags WHERE name = ? COLLATE NOCASE", tag.Name).Scan(&tagID)
-				if err != nil {
-					return fmt.Errorf("failed to get tag ID after creation: %w", err)
-				}
-			} else {
-				tagID, err = result.LastInsertId()
-				if err != nil {
-					return fmt.Errorf("failed to get last insert ID: %w", err)
-				}
+		// Follow the tag's alias, if any
+		var name string
+		if err := tx.QueryRow("SELECT "+aliasLookupSQL, tag.Name, tag.Name).Scan(&name); err != nil {
+			return fmt.Errorf("failed to resolve alias for tag %s: %w", tag.Name, err)
+		}
+
+		tagID, err := getOrCreateTagIDTx(tx, name, tag.Category)
+		if err != nil {
+			return err
+		}
+
+		if tag.ExplicitCategory {
+			if err := promoteGeneralTagTx(tx, tagID, tag.Category); err != nil {
+				return err
 			}
-		} else if err != nil {
-			return fmt.Errorf("failed to query tag: %w", err)
 		}
 
 		// Add tag to media
 		_, err = tx.Exec("INSERT OR IGNORE INTO media_tags (media_id, tag_id, created_at) VALUES (?, ?, ?)",
 			mediaID, tagID, now)
 		if err != nil {
-			return fmt.Errorf("failed to add tag %s to media: %w", tag.Name, err)
+			return fmt.Errorf("failed to add tag %s to media: %w", name, err)
+		}
+
+		if err := addImpliedTagsTx(tx, mediaID, tagID, now); err != nil {
+			return err
 		}
 	}
 
@@ -203,6 +469,160 @@ func AddTagsToMediaInTx(tx *sql.Tx, mediaID int64, tags []models.CreateTagInput)
 	return addTagsToMediaWithTx(tx, mediaID, tags)
 }
 
+// SetMediaTags replaces the tags of a media item with the given tags in one transaction. Tags are
+// added the same way as by AddTagsToMediaTx, following aliases and implications and moving general
+// tags given an explicit category, and every other tag is removed. It returns what changed.
+func (db *DB) SetMediaTags(mediaID int64, tags []models.CreateTagInput) (*models.MediaTagChanges, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, WrapTransactionBeginError(err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM media WHERE id = ?)", mediaID).Scan(&exists); err != nil {
+		return nil, WrapGetByIDError("media", err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	before, err := mediaTagsTx(tx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Categories of the named tags that already exist, to spot the ones tagging recategorizes
+	categories, err := tagCategoriesTx(tx, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addTagsToMediaWithTx(tx, mediaID, tags); err != nil {
+		return nil, err
+	}
+
+	// Everything the tags resolve to or imply is kept; the rest of the old tags are removed
+	keep := make(map[int64]bool)
+	for _, tag := range tags {
+		var id int64
+		err := tx.QueryRow("SELECT id FROM tags WHERE name = "+aliasLookupSQL+" COLLATE NOCASE", tag.Name, tag.Name).Scan(&id)
+		if err != nil {
+			return nil, WrapGetByNameError("tag", err)
+		}
+		keep[id] = true
+
+		implied, err := tx.Query(impliedTagsCTE+`SELECT id FROM implied`, id)
+		if err != nil {
+			return nil, WrapQueryError("implied tags", err)
+		}
+		for implied.Next() {
+			var impliedID int64
+			if err := implied.Scan(&impliedID); err != nil {
+				implied.Close()
+				return nil, WrapScanError("implied tag", err)
+			}
+			keep[impliedID] = true
+		}
+		err = implied.Err()
+		implied.Close()
+		if err != nil {
+			return nil, WrapIterationError("implied tag", err)
+		}
+	}
+
+	changes := &models.MediaTagChanges{
+		MediaID:       mediaID,
+		Added:         []*models.Tag{},
+		Removed:       []*models.Tag{},
+		Recategorized: []models.TagRecategorization{},
+	}
+
+	beforeIDs := make(map[int64]bool, len(before))
+	for _, tag := range before {
+		beforeIDs[tag.ID] = true
+		if keep[tag.ID] {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM media_tags WHERE media_id = ? AND tag_id = ?", mediaID, tag.ID); err != nil {
+			return nil, WrapExecError("remove tag from media", err)
+		}
+		changes.Removed = append(changes.Removed, tag)
+	}
+
+	after, err := mediaTagsTx(tx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range after {
+		if !beforeIDs[tag.ID] {
+			changes.Added = append(changes.Added, tag)
+		}
+		if from, known := categories[tag.ID]; known && from != tag.Category {
+			changes.Recategorized = append(changes.Recategorized, models.TagRecategorization{
+				TagID: tag.ID, Name: tag.Name, From: from, To: tag.Category,
+			})
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, WrapTransactionCommitError(err)
+	}
+
+	return changes, nil
+}
+
+// tagCategoriesTx returns the current category of each of the tags that exists, by tag ID,
+// following aliases the same way tagging does
+func tagCategoriesTx(tx *sql.Tx, tags []models.CreateTagInput) (map[int64]models.TagCategory, error) {
+	categories := make(map[int64]models.TagCategory)
+	for _, tag := range tags {
+		var id int64
+		var category models.TagCategory
+		err := tx.QueryRow("SELECT id, category FROM tags WHERE name = "+aliasLookupSQL+" COLLATE NOCASE", tag.Name, tag.Name).Scan(&id, &category)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, WrapGetByNameError("tag", err)
+		}
+		categories[id] = category
+	}
+	return categories, nil
+}
+
+// mediaTagsTx retrieves all tags for a media item within a transaction, ordered like GetTagsByMediaID
+func mediaTagsTx(tx *sql.Tx, mediaID int64) ([]*models.Tag, error) {
+	query := `
+		SELECT t.id, t.name, t.category, t.usage_count, t.created_at
+		FROM tags t
+		JOIN media_tags mt ON t.id = mt.tag_id
+		WHERE mt.media_id = ?
+		ORDER BY t.category, t.name
+	`
+
+	rows, err := tx.Query(query, mediaID)
+	if err != nil {
+		return nil, WrapQueryError("media tags", err)
+	}
+	defer rows.Close()
+
+	var tags []*models.Tag
+	for rows.Next() {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Category, &tag.UsageCount, &tag.CreatedAt); err != nil {
+			return nil, WrapScanError("tag", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, WrapIterationError("tag", err)
+	}
+
+	return tags, nil
+}
+
 // RemoveTagFromMedia removes a tag association from a media item
 func (db *DB) RemoveTagFromMedia(mediaID, tagID int64) error {
 	result, err := db.Exec("DELETE FROM media_tags WHERE media_id = ? AND tag_id = ?", mediaID, tagID)
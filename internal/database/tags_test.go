@@ -154,3 +154,192 @@ func TestDeleteTag(t *testing.T) {
 	err = db.DeleteTag(999999)
 	AssertError(t, err, "DeleteTag should fail for non-existent tag")
 }
+
+func TestRenameTag(t *testing.T) {
+	db := SetupTestDB(t)
+
+	mediaID := createTestMedia(t, db, "kitty")
+	createTestMedia(t, db, "dog")
+	_, err := db.CreateTagAlias("kitten", "kitty", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+	_, err = db.CreateTagAlias("puppy", "dog", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	kitty, err := db.GetTagByName("kitty")
+	AssertNoError(t, err, "GetTagByName failed")
+
+	AssertError(t, db.RenameTag(kitty.ID, "DOG"), "renaming onto another tag should fail")
+	AssertError(t, db.RenameTag(kitty.ID, "puppy"), "renaming onto an alias should fail")
+	AssertError(t, db.RenameTag(kitty.ID, " "), "empty names should be rejected")
+	AssertEqual(t, db.RenameTag(999999, "cat"), ErrNotFound, "missing tag")
+
+	AssertNoError(t, db.RenameTag(kitty.ID, "Kitty"), "case-only rename failed")
+	AssertNoError(t, db.RenameTag(kitty.ID, "cat"), "RenameTag failed")
+
+	tags, err := db.GetTagsByMediaID(mediaID)
+	AssertNoError(t, err, "GetTagsByMediaID failed")
+	AssertEqual(t, tagNames(tags), []string{"cat"}, "media should keep the renamed tag")
+
+	alias, err := db.GetTagAliasByAntecedent("kitten")
+	AssertNoError(t, err, "GetTagAliasByAntecedent failed")
+	AssertEqual(t, alias.ConsequentName, "cat", "aliases should follow the rename")
+}
+
+func TestMergeTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	both := createTestMedia(t, db, "cat")
+	onlyFrom := createTestMedia(t, db)
+	AssertNoError(t, db.AddTagsToMediaTx(both, []models.CreateTagInput{
+		{Name: "neko", Category: models.TagCategoryCharacter},
+	}), "AddTagsToMediaTx failed")
+	AssertNoError(t, db.AddTagsToMediaTx(onlyFrom, []models.CreateTagInput{{Name: "neko"}}), "AddTagsToMediaTx failed")
+
+	neko, err := db.GetTagByName("neko")
+	AssertNoError(t, err, "GetTagByName failed")
+	cat, err := db.GetTagByName("cat")
+	AssertNoError(t, err, "GetTagByName failed")
+
+	animal := createTestTag(t, db, "animal", models.TagCategoryGeneral)
+	_, err = db.CreateTagImplication(neko.ID, animal)
+	AssertNoError(t, err, "CreateTagImplication failed")
+	_, err = db.CreateTagImplication(neko.ID, cat.ID)
+	AssertNoError(t, err, "CreateTagImplication failed")
+	_, err = db.CreateTagAlias("nekomimi", "neko", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+
+	AssertError(t, db.MergeTags(cat.ID, cat.ID, false), "merging a tag into itself should fail")
+	AssertEqual(t, db.MergeTags(999999, cat.ID, false), ErrNotFound, "missing tag")
+
+	AssertNoError(t, db.MergeTags(neko.ID, cat.ID, true), "MergeTags failed")
+
+	_, err = db.GetTagByID(neko.ID)
+	AssertEqual(t, err, ErrNotFound, "merged tag should be deleted")
+
+	cat, err = db.GetTagByID(cat.ID)
+	AssertNoError(t, err, "GetTagByID failed")
+	AssertEqual(t, cat.UsageCount, 2, "usage count of the merged tag")
+
+	for _, id := range []int64{both, onlyFrom} {
+		tags, err := db.GetTagsByMediaID(id)
+		AssertNoError(t, err, "GetTagsByMediaID failed")
+		AssertEqual(t, tagNames(tags), []string{"cat"}, "media tags after merge")
+
+		media, err := db.GetMediaByID(id)
+		AssertNoError(t, err, "GetMediaByID failed")
+		AssertEqual(t, media.TagCount, 1, "tag count")
+		AssertEqual(t, media.TagCountGeneral, 1, "general tag count")
+		AssertEqual(t, media.TagCountCharacter, 0, "character tag count")
+	}
+
+	implied, err := db.GetImpliedTags(cat.ID)
+	AssertNoError(t, err, "GetImpliedTags failed")
+	AssertEqual(t, tagNames(implied), []string{"animal"}, "implications should move to the merged tag")
+
+	for _, name := range []string{"neko", "nekomimi"} {
+		alias, err := db.GetTagAliasByAntecedent(name)
+		AssertNoError(t, err, "GetTagAliasByAntecedent failed")
+		AssertEqual(t, alias.ConsequentName, "cat", "alias of "+name)
+	}
+}
+
+func TestSetTagCategory(t *testing.T) {
+	db := SetupTestDB(t)
+
+	mediaID := createTestMedia(t, db, "miku", "cat")
+	miku, err := db.GetTagByName("miku")
+	AssertNoError(t, err, "GetTagByName failed")
+
+	AssertError(t, db.SetTagCategory(miku.ID, models.TagCategory(7)), "unknown categories should be rejected")
+	AssertEqual(t, db.SetTagCategory(999999, models.TagCategoryArtist), ErrNotFound, "missing tag")
+
+	AssertNoError(t, db.SetTagCategory(miku.ID, models.TagCategoryCharacter), "SetTagCategory failed")
+
+	media, err := db.GetMediaByID(mediaID)
+	AssertNoError(t, err, "GetMediaByID failed")
+	AssertEqual(t, media.TagCount, 2, "tag count")
+	AssertEqual(t, media.TagCountGeneral, 1, "general tag count")
+	AssertEqual(t, media.TagCountCharacter, 1, "character tag count")
+
+	// Removing the tag afterwards must not underflow the counts of its new category
+	AssertNoError(t, db.RemoveTagFromMedia(mediaID, miku.ID), "RemoveTagFromMedia failed")
+	media, err = db.GetMediaByID(mediaID)
+	AssertNoError(t, err, "GetMediaByID failed")
+	AssertEqual(t, media.TagCountGeneral, 1, "general tag count after removal")
+	AssertEqual(t, media.TagCountCharacter, 0, "character tag count after removal")
+}
+
+func TestExplicitCategoryPromotesGeneralTag(t *testing.T) {
+	db := SetupTestDB(t)
+
+	first := createTestMedia(t, db, "someone")
+	second := createTestMedia(t, db)
+
+	AssertNoError(t, db.AddTagsToMediaTx(second, []models.CreateTagInput{
+		{Name: "someone", Category: models.TagCategoryArtist, ExplicitCategory: true},
+	}), "AddTagsToMediaTx failed")
+
+	tag, err := db.GetTagByName("someone")
+	AssertNoError(t, err, "GetTagByName failed")
+	AssertEqual(t, tag.Category, models.TagCategoryArtist, "general tag should be promoted")
+
+	for _, id := range []int64{first, second} {
+		media, err := db.GetMediaByID(id)
+		AssertNoError(t, err, "GetMediaByID failed")
+		AssertEqual(t, media.TagCountGeneral, 0, "general tag count")
+		AssertEqual(t, media.TagCountArtist, 1, "artist tag count")
+	}
+
+	// Only general tags are promoted
+	AssertNoError(t, db.AddTagsToMediaTx(first, []models.CreateTagInput{
+		{Name: "someone", Category: models.TagCategoryCharacter, ExplicitCategory: true},
+	}), "AddTagsToMediaTx failed")
+	tag, err = db.GetTagByName("someone")
+	AssertNoError(t, err, "GetTagByName failed")
+	AssertEqual(t, tag.Category, models.TagCategoryArtist, "categorized tag should be kept")
+}
+
+func TestSetMediaTags(t *testing.T) {
+	db := SetupTestDB(t)
+
+	mediaID := createTestMedia(t, db, "cat", "wip", "someone")
+	_, err := db.CreateTagAlias("kitty", "cat", false)
+	AssertNoError(t, err, "CreateTagAlias failed")
+	animal := createTestTag(t, db, "animal", models.TagCategoryGeneral)
+	dog, err := db.GetOrCreateTag("dog", models.TagCategoryGeneral)
+	AssertNoError(t, err, "GetOrCreateTag failed")
+	_, err = db.CreateTagImplication(dog.ID, animal)
+	AssertNoError(t, err, "CreateTagImplication failed")
+
+	changes, err := db.SetMediaTags(mediaID, []models.CreateTagInput{
+		{Name: "kitty"},
+		{Name: "dog"},
+		{Name: "someone", Category: models.TagCategoryArtist, ExplicitCategory: true},
+	})
+	AssertNoError(t, err, "SetMediaTags failed")
+
+	AssertEqual(t, changes.MediaID, mediaID, "media ID")
+	AssertEqual(t, tagNames(changes.Added), []string{"animal", "dog"}, "added tags")
+	AssertEqual(t, tagNames(changes.Removed), []string{"wip"}, "removed tags")
+	AssertEqual(t, len(changes.Recategorized), 1, "recategorized tags")
+	AssertEqual(t, changes.Recategorized[0].Name, "someone", "recategorized tag")
+	AssertEqual(t, changes.Recategorized[0].From, models.TagCategoryGeneral, "previous category")
+	AssertEqual(t, changes.Recategorized[0].To, models.TagCategoryArtist, "new category")
+
+	tags, err := db.GetTagsByMediaID(mediaID)
+	AssertNoError(t, err, "GetTagsByMediaID failed")
+	AssertEqual(t, tagNames(tags), []string{"animal", "cat", "dog", "someone"}, "media tags")
+
+	media, err := db.GetMediaByID(mediaID)
+	AssertNoError(t, err, "GetMediaByID failed")
+	AssertEqual(t, media.TagCount, 4, "tag count")
+	AssertEqual(t, media.TagCountGeneral, 3, "general tag count")
+	AssertEqual(t, media.TagCountArtist, 1, "artist tag count")
+
+	changes, err = db.SetMediaTags(mediaID, []models.CreateTagInput{{Name: "cat"}, {Name: "dog"}, {Name: "someone"}})
+	AssertNoError(t, err, "SetMediaTags failed")
+	AssertEqual(t, len(changes.Added)+len(changes.Removed)+len(changes.Recategorized), 0, "unchanged tags should report nothing")
+
+	_, err = db.SetMediaTags(999999, nil)
+	AssertEqual(t, err, ErrNotFound, "missing media")
+}
@@ -1,18 +1,15 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"testing"
 )
 
-func SetupTestDB(t *testing.T) *DB {
+func SetupTestDB(t testing.TB) *DB {
 	t.Helper()
 
-	db, err := sql.Open("sqlite3", ":memory:?_foreign_keys=on")
-	if err != nil {
-		t.Fatalf("Failed to open test database: %v", err)
-	}
+	dbInstance := openDB(":memory:?_foreign_keys=on")
+	db := dbInstance.DB
 
 	if err := configurePragmas(db); err != nil {
 		t.Fatalf("Failed to configure pragmas: %v", err)
@@ -22,8 +19,6 @@ func SetupTestDB(t *testing.T) *DB {
 		t.Fatalf("Failed to initialize schema: %v", err)
 	}
 
-	dbInstance := &DB{DB: db}
-
 	t.Cleanup(func() {
 		if err := db.Close(); err != nil {
 			t.Errorf("Failed to close test database: %v", err)
@@ -0,0 +1,57 @@
+// Package editdist computes the optimal string alignment distance used to match misspelled tag
+// names and search keywords: inserting, deleting or substituting a rune, or swapping two adjacent
+// runes, each count as one edit.
+package editdist
+
+// Row fills in one row of the distance table between pattern and a word: row[j] becomes the
+// distance between the first n runes of the word and the first j runes of pattern, where r and
+// prev are the word's n-th and (n-1)-th runes. above and aboveAbove hold the rows for its first
+// n-1 and n-2 runes; prev and aboveAbove are not used when n is 1. Row returns the smallest
+// distance in the row, which no longer word with the same first n runes can get below.
+func Row(pattern []rune, row, above, aboveAbove []int, n int, r, prev rune) int {
+	row[0] = n
+	rowMin := n
+	for j := 1; j <= len(pattern); j++ {
+		cost := 1
+		if pattern[j-1] == r {
+			cost = 0
+		}
+		row[j] = min(above[j]+1, row[j-1]+1, above[j-1]+cost)
+		if n > 1 && j > 1 && pattern[j-1] == prev && pattern[j-2] == r {
+			row[j] = min(row[j], aboveAbove[j-2]+1)
+		}
+		rowMin = min(rowMin, row[j])
+	}
+	return rowMin
+}
+
+// FirstRow fills in the row of the distance table for an empty word
+func FirstRow(row []int) {
+	for j := range row {
+		row[j] = j
+	}
+}
+
+// Distance returns the distance between a and b, or maxDistance+1 as soon as it is certain
+// to exceed maxDistance
+func Distance(a, b []rune, maxDistance int) int {
+	if len(a)-len(b) > maxDistance || len(b)-len(a) > maxDistance {
+		return maxDistance + 1
+	}
+
+	rows := [3][]int{make([]int, len(b)+1), make([]int, len(b)+1), make([]int, len(b)+1)}
+	FirstRow(rows[1])
+	for i := 1; i <= len(a); i++ {
+		aboveAbove, above, row := rows[0], rows[1], rows[2]
+		var prev rune
+		if i > 1 {
+			prev = a[i-2]
+		}
+		if Row(b, row, above, aboveAbove, i, a[i-1], prev) > maxDistance {
+			return maxDistance + 1
+		}
+		rows[0], rows[1], rows[2] = above, row, aboveAbove
+	}
+
+	return min(rows[1][len(b)], maxDistance+1)
+}
@@ -0,0 +1,32 @@
+package editdist
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b        string
+		maxDistance int
+		want        int
+	}{
+		{a: "", b: "", maxDistance: 2, want: 0},
+		{a: "rating", b: "rating", maxDistance: 2, want: 0},
+		{a: "raiting", b: "rating", maxDistance: 2, want: 1},
+		{a: "explict", b: "explicit", maxDistance: 2, want: 1},
+		{a: "cta", b: "cat", maxDistance: 2, want: 1},
+		{a: "lnog_hair", b: "long_hair", maxDistance: 2, want: 1},
+		{a: "kitten", b: "sitting", maxDistance: 3, want: 3},
+		{a: "kitten", b: "sitting", maxDistance: 2, want: 3},
+		{a: "", b: "abc", maxDistance: 3, want: 3},
+		{a: "abcdef", b: "a", maxDistance: 2, want: 3},
+		{a: "猫耳", b: "猫", maxDistance: 2, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := Distance([]rune(tt.a), []rune(tt.b), tt.maxDistance); got != tt.want {
+			t.Errorf("Distance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.maxDistance, got, tt.want)
+		}
+		if got := Distance([]rune(tt.b), []rune(tt.a), tt.maxDistance); got != tt.want {
+			t.Errorf("Distance(%q, %q, %d) = %d, want %d", tt.b, tt.a, tt.maxDistance, got, tt.want)
+		}
+	}
+}
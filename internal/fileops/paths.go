@@ -53,7 +53,8 @@ type AppPaths struct {
 	Config       string
 }
 
-func InitPaths() (AppPaths, error) {
+// GetAppPaths returns the locations of the application's files without creating anything
+func GetAppPaths() (AppPaths, error) {
 	appDir, err := GetAppDir()
 	if err != nil {
 		return AppPaths{}, err
@@ -61,7 +62,7 @@ func InitPaths() (AppPaths, error) {
 
 	binDir := filepath.Join(appDir, "bin")
 
-	paths := AppPaths{
+	return AppPaths{
 		AppDir:       appDir,
 		MediaDir:     filepath.Join(appDir, "media"),
 		ThumbnailDir: filepath.Join(appDir, "thumbnail"),
@@ -71,8 +72,18 @@ func InitPaths() (AppPaths, error) {
 		FFprobe:      filepath.Join(binDir, "ffprobe"),
 		DB:           filepath.Join(appDir, "data.db"),
 		Config:       filepath.Join(appDir, "config.json"),
+	}, nil
+}
+
+// InitPaths returns the locations of the application's files, creating the directories
+func InitPaths() (AppPaths, error) {
+	paths, err := GetAppPaths()
+	if err != nil {
+		return AppPaths{}, err
 	}
 
+	binDir := filepath.Dir(paths.FFmpeg)
+
 	// Ensure directories exist
 	dirs := []string{
 		paths.AppDir,
@@ -4,23 +4,51 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrInvalidPort      = fmt.Errorf("invalid port number provided")
 	ErrInvalidThumbSize = fmt.Errorf("invalid thumbnail size provided")
+	ErrInvalidPIN       = fmt.Errorf("safe mode PIN must be at least 4 characters")
+	ErrWrongPIN         = fmt.Errorf("incorrect safe mode PIN")
+	ErrNoSafeRatings    = fmt.Errorf("safe mode needs at least one valid rating")
+	ErrSafeModeEnabled  = fmt.Errorf("safe mode is already on")
+	ErrSafeModeLocked   = fmt.Errorf("not available while safe mode is on")
 )
 
+// minPINLength is the shortest PIN accepted for unlocking safe mode
+const minPINLength = 4
+
 type Config struct {
-	AppDir        string `json:"app_dir"`
-	Port          int    `json:"port"`
-	ThumbnailSize int    `json:"thumbnail_sizes"`
+	AppDir              string `json:"app_dir"`
+	Port                int    `json:"port"`
+	ThumbnailSize       int    `json:"thumbnail_sizes"`
+	RecordSearchHistory bool   `json:"record_search_history"`
+
+	// Blacklist holds search expressions, such as "gore" or "spider -cartoon", whose
+	// matches are hidden from every search unless it uses /blacklist:off
+	Blacklist []string `json:"blacklist"`
+
+	// SafeMode restricts every search and media lookup to SafeModeRatings. Turning it off takes
+	// the PIN it was turned on with, so ModifyConfig leaves these fields alone.
+	SafeMode        bool     `json:"safe_mode"`
+	SafeModeRatings []Rating `json:"safe_mode_ratings"`
+	SafeModePIN     string   `json:"safe_mode_pin"` // bcrypt hash of the PIN
+
+	// mu guards the settings that change while the app runs, which the HTTP server reads from
+	// its own goroutines. Use Snapshot to read several of them at once.
+	mu sync.RWMutex
 }
 
 func DefaultConfig() *Config {
 	return &Config{
-		Port:          2234,
-		ThumbnailSize: 256,
+		Port:                2234,
+		ThumbnailSize:       256,
+		RecordSearchHistory: true,
 	}
 }
 
@@ -33,12 +61,13 @@ func LoadConfig(path string) (*Config, error) {
 		return config, nil
 	}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	// Start from the defaults so settings missing from older config files keep their default values
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 func (c *Config) ModifyConfig(newConfig *Config, configPath string) error {
@@ -48,15 +77,128 @@ func (c *Config) ModifyConfig(newConfig *Config, configPath string) error {
 	if c.ThumbnailSize < 0 {
 		return ErrInvalidThumbSize
 	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.Port = newConfig.Port
 	c.ThumbnailSize = newConfig.ThumbnailSize
-	return c.Save(configPath)
+	c.RecordSearchHistory = newConfig.RecordSearchHistory
+	c.Blacklist = newConfig.Blacklist
+	return c.save(configPath)
 }
 
 func (c *Config) Save(path string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.save(path)
+}
+
+// save writes the config to path. Must be called with c.mu held.
+func (c *Config) save(path string) error {
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(path, data, 0644)
 }
+
+// Snapshot returns a copy of the config that is safe to read while the config changes
+func (c *Config) Snapshot() *Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &Config{
+		AppDir:              c.AppDir,
+		Port:                c.Port,
+		ThumbnailSize:       c.ThumbnailSize,
+		RecordSearchHistory: c.RecordSearchHistory,
+		Blacklist:           slices.Clone(c.Blacklist),
+		SafeMode:            c.SafeMode,
+		SafeModeRatings:     slices.Clone(c.SafeModeRatings),
+		SafeModePIN:         c.SafeModePIN,
+	}
+}
+
+// AllowedRatings returns the ratings safe mode restricts media to, or nil when safe mode is off
+func (c *Config) AllowedRatings() []Rating {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.SafeMode {
+		return nil
+	}
+	if len(c.SafeModeRatings) == 0 {
+		return []Rating{RatingSafe}
+	}
+	return c.SafeModeRatings
+}
+
+// AllowsRating reports whether media with the given rating may be shown
+func (c *Config) AllowsRating(rating Rating) bool {
+	allowed := c.AllowedRatings()
+	if allowed == nil {
+		return true
+	}
+	for _, r := range allowed {
+		if r == rating {
+			return true
+		}
+	}
+	return false
+}
+
+// EnableSafeMode turns safe mode on for the given ratings. The PIN is needed to turn it off again.
+func (c *Config) EnableSafeMode(ratings []Rating, pin string, configPath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.SafeMode {
+		return ErrSafeModeEnabled
+	}
+	if len(pin) < minPINLength {
+		return ErrInvalidPIN
+	}
+
+	var allowed []Rating
+	for _, r := range ratings {
+		switch r {
+		case RatingSafe, RatingQuestionable, RatingExplicit:
+			allowed = append(allowed, r)
+		default:
+			return fmt.Errorf("%w: unknown rating %q", ErrNoSafeRatings, r)
+		}
+	}
+	if len(allowed) == 0 {
+		return ErrNoSafeRatings
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	c.SafeMode = true
+	c.SafeModeRatings = allowed
+	c.SafeModePIN = string(hash)
+	return c.save(configPath)
+}
+
+// DisableSafeMode turns safe mode off if the PIN matches the one it was turned on with
+func (c *Config) DisableSafeMode(pin string, configPath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.SafeMode {
+		return nil
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(c.SafeModePIN), []byte(pin)) != nil {
+		return ErrWrongPIN
+	}
+
+	c.SafeMode = false
+	c.SafeModePIN = ""
+	return c.save(configPath)
+}
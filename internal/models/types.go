@@ -34,6 +34,22 @@ const (
 	TagCategoryMetadata  TagCategory = 4
 )
 
+// SortField represents the column search results are ordered by
+type SortField string
+
+const (
+	SortByID         SortField = "id"
+	SortByFileSize   SortField = "filesize"
+	SortByWidth      SortField = "width"
+	SortByHeight     SortField = "height"
+	SortByPixels     SortField = "mpixels"
+	SortByDuration   SortField = "duration"
+	SortByTagCount   SortField = "tagcount"
+	SortByLastViewed SortField = "viewed"
+	SortByUpdated    SortField = "updated"
+	SortByRandom     SortField = "random"
+)
+
 // Media represents a media file in the database
 type Media struct {
 	ID                int64
@@ -71,6 +87,22 @@ type Tag struct {
 	CreatedAt  int64
 }
 
+// TagRecategorization records a tag moved from one category to another
+type TagRecategorization struct {
+	TagID int64
+	Name  string
+	From  TagCategory
+	To    TagCategory
+}
+
+// MediaTagChanges summarizes an edit of the tags of a media item, with enough detail to reverse it
+type MediaTagChanges struct {
+	MediaID       int64
+	Added         []*Tag
+	Removed       []*Tag
+	Recategorized []TagRecategorization
+}
+
 // MediaTag represents the junction table between media and tags
 type MediaTag struct {
 	ID        int64
@@ -88,6 +120,52 @@ type ViewHistory struct {
 	SessionID    sql.NullString
 }
 
+// TagSuggestion is a tag autocompletion result
+type TagSuggestion struct {
+	ID         int64
+	Name       string
+	Category   TagCategory
+	UsageCount int
+	Alias      string // The alias that matched, if the tag was found through one
+}
+
+// TagCorrection offers replacements for a search term that matches no known tag
+type TagCorrection struct {
+	Offset      int    // Rune offset of the term in the query
+	Length      int    // Length of the term in runes
+	Term        string // The term as written
+	Suggestions []*TagSuggestion
+}
+
+// RelatedTag is a tag that occurs among the media matching a search
+type RelatedTag struct {
+	Tag         *Tag
+	Frequency   int     // Number of matching media with the tag
+	Share       float64 // Frequency as a fraction of all matching media
+	Specificity float64 // Frequency as a fraction of the tag's overall usage; 1 means the tag only occurs in the results
+}
+
+// RelatedTagGroup holds the related tags of a single category, most frequent first
+type RelatedTagGroup struct {
+	Category TagCategory
+	Tags     []*RelatedTag
+}
+
+// FacetValue is one value of a search facet and the number of matching media that have it
+type FacetValue struct {
+	Value string
+	Count int64
+	Query string // The search refined to media with this value, empty if the value can't be written as a filter
+}
+
+// SearchFacets breaks the media matching a search down by property, most common values first
+type SearchFacets struct {
+	Rating    []FacetValue
+	MediaType []FacetValue
+	Favorite  []FacetValue
+	Extension []FacetValue
+}
+
 // TagAlias represents a tag alias
 type TagAlias struct {
 	ID             int64
@@ -112,6 +190,13 @@ type SearchHistory struct {
 	SearchedAt  int64
 }
 
+// SearchFrequency summarizes how often a query appears in the search history
+type SearchFrequency struct {
+	Query          string
+	Count          int
+	LastSearchedAt int64
+}
+
 // SavedSearch represents a saved search query
 type SavedSearch struct {
 	ID         int64
@@ -164,14 +249,35 @@ type UpdateMediaInput struct {
 type CreateTagInput struct {
 	Name     string
 	Category TagCategory
+	// ExplicitCategory is set when the category was written out, as in artist:name. Tagging with
+	// an explicit category recategorizes an existing general tag.
+	ExplicitCategory bool
+}
+
+// QueryNodeKind identifies the kind of a node in a search expression tree
+type QueryNodeKind int
+
+const (
+	QueryNodeTag      QueryNodeKind = iota // Value holds a tag name
+	QueryNodeWildcard                      // Value holds a glob pattern such as artist_*
+	QueryNodeAnd                           // Every child must match
+	QueryNodeOr                            // At least one child must match
+	QueryNodeNot                           // The single child must not match
+	QueryNodeFilter                        // Filter holds the conditions of one or more /filter:value terms
+)
+
+// QueryNode is a node in the boolean expression tree produced by the query parser
+type QueryNode struct {
+	Kind     QueryNodeKind
+	Value    string
+	Children []*QueryNode
+	Filter   *SearchQuery
 }
 
 // SearchQuery represents a media search query
 type SearchQuery struct {
-	IncludeTags   []string
-	OptionalTags  []string
-	ExcludeTags   []string
-	WildcardTags  []string
+	Expr *QueryNode // Boolean tag expression; nil matches everything
+
 	Rating        []Rating
 	MinWidth      *int64
 	MaxWidth      *int64
@@ -179,13 +285,41 @@ type SearchQuery struct {
 	MaxHeight     *int64
 	MinFileSize   *int64
 	MaxFileSize   *int64
+	MinDuration   *float64 // Seconds
+	MaxDuration   *float64
+	MinRatio      *float64 // Width divided by height
+	MaxRatio      *float64
+	MinMegapixels *float64
+	MaxMegapixels *float64
+	TagCounts     []TagCountFilter
 	HasParent     *bool
 	HasChildren   *bool
 	ParentID      *int64
 	IsFavorite    *bool
 	CreatedAfter  *time.Time
 	CreatedBefore *time.Time
+	ViewedAfter   *time.Time
+	ViewedBefore  *time.Time
+	Viewed        *bool // false matches media that has never been viewed
 	MediaTypes    []MediaType
+	Extensions    []string // Lowercase file extensions without the dot
+	MinID         *int64
+	MaxID         *int64
+	MD5s          []string // Lowercase hex file hashes
+	Codecs        []string // Lowercase codec names as reported by ffprobe
+	MimeTypes     []string // Lowercase MIME types
+
+	// Restricts the results to these ratings whatever the query says; set by the caller for safe mode
+	AllowedRatings []Rating
+
+	// Media matching Blacklist are hidden from the results unless IgnoreBlacklist is set
+	Blacklist       *QueryNode
+	IgnoreBlacklist bool
+
+	// Ordering (default: newest first by ID)
+	OrderBy    SortField
+	OrderAsc   bool
+	RandomSeed int64 // Seed for SortByRandom; picked automatically when zero, except when paging by ID
 
 	// Pagination (offset-based for arbitrary page jumps)
 	Limit  int // Number of results per page (default: 20)
@@ -194,6 +328,26 @@ type SearchQuery struct {
 	// Cursor-based pagination (for efficient prev/next navigation)
 	BeforeID *int64 // Get results before this ID (for next page - older items)
 	AfterID  *int64 // Get results after this ID (for previous page - newer items)
+
+	// Opaque cursors from SearchResult, required to page reliably through non-id orders
+	BeforeCursor string // Get the page following this cursor
+	AfterCursor  string // Get the page preceding this cursor
+}
+
+// TagCountFilter bounds one of a media item's denormalized tag counts
+type TagCountFilter struct {
+	Category *TagCategory // nil for the total across all categories
+	Min      *int
+	Max      *int
+}
+
+// QueryDiagnostic describes a problem found while parsing a search query
+type QueryDiagnostic struct {
+	Offset     int    // Rune offset of the offending token in the query
+	Length     int    // Length of the offending token in runes
+	Token      string // The offending token as written
+	Message    string
+	Suggestion string // Replacement for the token, empty if there is no obvious fix
 }
 
 // FFprobeMetadata represents metadata extracted from ffprobe
@@ -213,4 +367,54 @@ type SearchResult struct {
 	FirstID    int64 // ID of first item in current page
 	LastID     int64 // ID of last item in current page
 	HasMore    bool  // Whether there are more results after this page
+
+	HiddenCount int64 // Number of matching media hidden by the blacklist, not included in TotalCount
+
+	FirstCursor string // Opaque cursor for the first item in current page
+	LastCursor  string // Opaque cursor for the last item in current page
+
+	RandomSeed int64 // Seed of a random order, to be sent back as /order:random:<seed> when paging by ID
+
+	Diagnostics []QueryDiagnostic // Problems found while parsing the query string
+	Corrections []TagCorrection   // Suggestions for included terms that aren't known tags
+}
+
+// CounterDiscrepancy is a denormalized counter whose stored value doesn't match the data it counts
+type CounterDiscrepancy struct {
+	Table  string // "media" or "tags"
+	ID     int64  // ID of the row holding the counter
+	Column string
+	Stored int64
+	Actual int64
+}
+
+// CounterAudit reports the counters found out of step by a consistency check
+type CounterAudit struct {
+	Discrepancies []CounterDiscrepancy
+	Fixed         bool // Whether the discrepancies were repaired
+}
+
+// TagDelta is a set of tag changes to apply to many media at once
+type TagDelta struct {
+	Add    []CreateTagInput
+	Remove []string // Names of the tags to remove
+}
+
+// BulkEditOptions controls how a bulk tag edit is run
+type BulkEditOptions struct {
+	DryRun      bool                  // Only count the matching media without changing anything
+	AllMedia    bool                  // Allow a query without conditions, which edits every media item
+	BatchSize   int                   // Media edited per transaction; zero uses the default
+	Description string                // Stored with the undo record, usually the query and delta as typed
+	Progress    func(done, total int) // Called after each batch, may be nil
+}
+
+// BulkTagEdit records a bulk tag edit so that it can be reviewed and undone
+type BulkTagEdit struct {
+	ID           int64 // Zero for a dry run
+	Description  string
+	MatchedCount int64 // Media that matched the query
+	ChangedCount int64 // Media whose tags actually changed
+	CreatedAt    int64
+	UndoneAt     *int64
 }
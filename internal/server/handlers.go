@@ -2,11 +2,18 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"mybooru/internal/database"
+	"mybooru/internal/models"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
+// defaultHistoryLimit is the number of search history entries returned when no limit is given
+const defaultHistoryLimit = 20
+
 func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/media/")
 	path = strings.TrimPrefix(path, "/")
@@ -20,6 +27,10 @@ func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
 	hash := strings.TrimSuffix(path, ext)
 	ext = strings.TrimPrefix(ext, ".")
 
+	if !s.allowedBySafeMode(w, r, hash) {
+		return
+	}
+
 	mediaPath, err := s.paths.GetMediaFilePath(hash, ext)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -41,7 +52,11 @@ func (s *Server) handleGetThumbnail(w http.ResponseWriter, r *http.Request) {
 	ext := filepath.Ext(path)
 	hash := strings.TrimSuffix(path, ext)
 
-	thumbPath, err := s.paths.GetThumbnailPath(hash, s.config.ThumbnailSize)
+	if !s.allowedBySafeMode(w, r, hash) {
+		return
+	}
+
+	thumbPath, err := s.paths.GetThumbnailPath(hash, s.config.Snapshot().ThumbnailSize)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -50,6 +65,25 @@ func (s *Server) handleGetThumbnail(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, thumbPath)
 }
 
+// allowedBySafeMode reports whether the media file with the given hash may be served. Files that
+// safe mode hides, or that don't belong to any media, get a 404 so their existence isn't revealed.
+func (s *Server) allowedBySafeMode(w http.ResponseWriter, r *http.Request, hash string) bool {
+	if s.config.AllowedRatings() == nil {
+		return true
+	}
+
+	media, err := s.db.GetMediaByMD5(hash)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && !s.config.AllowsRating(media.Rating)) {
+		http.NotFound(w, r)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
 func (s *Server) handleUploadInit(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		TotalSize int64 `json:"totalSize"`
@@ -87,7 +121,7 @@ func (s *Server) handleUploadFinalize(w http.ResponseWriter, r *http.Request) {
 	sessionID := r.URL.Query().Get("sessionID")
 	tagList := r.URL.Query().Get("tags")
 
-	mediaID, err := s.paths.FinalizeUpload(s.db, s.config, sessionID, tagList)
+	mediaID, err := s.paths.FinalizeUpload(s.db, s.config.Snapshot(), sessionID, tagList)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -98,3 +132,97 @@ func (s *Server) handleUploadFinalize(w http.ResponseWriter, r *http.Request) {
 		"mediaID": mediaID,
 	})
 }
+
+// parseLimit reads the optional "limit" query parameter
+func parseLimit(r *http.Request, fallback int) (int, bool) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return fallback, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, false
+	}
+	return limit, true
+}
+
+func (s *Server) handleGetRecentSearches(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r, defaultHistoryLimit)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	// The history isn't limited by rating, so safe mode hides all of it
+	history := []*models.SearchHistory{}
+	var err error
+	if s.config.AllowedRatings() == nil {
+		history, err = s.db.GetRecentSearches(limit)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+func (s *Server) handleGetFrequentSearches(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r, defaultHistoryLimit)
+	if !ok {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	searches := []*models.SearchFrequency{}
+	var err error
+	if s.config.AllowedRatings() == nil {
+		searches, err = s.db.GetFrequentSearches(limit)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(searches)
+}
+
+func (s *Server) handleDeleteSearchHistory(w http.ResponseWriter, r *http.Request) {
+	if s.config.AllowedRatings() != nil {
+		http.Error(w, models.ErrSafeModeLocked.Error(), http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid history ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.DeleteSearchHistory(id); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "History entry not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleClearSearchHistory(w http.ResponseWriter, r *http.Request) {
+	if s.config.AllowedRatings() != nil {
+		http.Error(w, models.ErrSafeModeLocked.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := s.db.ClearSearchHistory(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -10,6 +10,10 @@ func (s *Server) setupRoutes() *http.ServeMux {
 	mux.HandleFunc("POST /upload/init", s.handleUploadInit)
 	mux.HandleFunc("POST /upload/chunk", s.handleUploadChunk)
 	mux.HandleFunc("POST /upload/finalize", s.handleUploadFinalize)
+	mux.HandleFunc("GET /history/recent", s.handleGetRecentSearches)
+	mux.HandleFunc("GET /history/frequent", s.handleGetFrequentSearches)
+	mux.HandleFunc("DELETE /history/{id}", s.handleDeleteSearchHistory)
+	mux.HandleFunc("DELETE /history", s.handleClearSearchHistory)
 
 	return mux
 }
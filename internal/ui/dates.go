@@ -0,0 +1,158 @@
+package ui
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeNow is the clock relative dates are measured against, replaceable in tests
+var timeNow = time.Now
+
+// timestampLayout is the most precise date format, a single second with its UTC offset.
+// FormatQuery uses it for bounds that don't fall on day boundaries, such as those of /age:.
+const timestampLayout = "2006-01-02T15:04:05Z07:00"
+
+// dateLayouts lists the accepted absolute date formats, from most to least precise.
+// A date stands for the whole period it names, so 2024-05 covers all of May 2024.
+var dateLayouts = []struct {
+	layout string
+	next   func(time.Time) time.Time
+}{
+	{layout: timestampLayout, next: func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{layout: "2006-01-02", next: func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{layout: "2006-01", next: func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{layout: "2006", next: func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+// parsePeriod parses an absolute date into the half-open period [start, end) it covers, in local time
+func parsePeriod(s string) (time.Time, time.Time, bool) {
+	for _, l := range dateLayouts {
+		if t, err := time.ParseInLocation(l.layout, s, time.Local); err == nil {
+			return t, l.next(t), true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// parseAge parses a relative age such as 7d or 3mo into the instant that lies that far in the past
+func parseAge(s string, now time.Time) (time.Time, bool) {
+	units := []struct {
+		suffix string
+		apply  func(n int) time.Time
+	}{
+		{suffix: "mo", apply: func(n int) time.Time { return now.AddDate(0, -n, 0) }},
+		{suffix: "h", apply: func(n int) time.Time { return now.Add(-time.Duration(n) * time.Hour) }},
+		{suffix: "d", apply: func(n int) time.Time { return now.AddDate(0, 0, -n) }},
+		{suffix: "w", apply: func(n int) time.Time { return now.AddDate(0, 0, -7*n) }},
+		{suffix: "y", apply: func(n int) time.Time { return now.AddDate(-n, 0, 0) }},
+	}
+
+	for _, u := range units {
+		digits, ok := strings.CutSuffix(s, u.suffix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 0 {
+			return time.Time{}, false
+		}
+		return u.apply(n), true
+	}
+	return time.Time{}, false
+}
+
+// isAge reports whether a date filter operand is a relative age rather than an absolute date
+func isAge(s string) bool {
+	_, ok := parseAge(s, time.Time{})
+	return ok
+}
+
+// splitComparison separates a leading comparison operator from its operand
+func splitComparison(s string) (string, string) {
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if operand, ok := strings.CutPrefix(s, op); ok {
+			return op, operand
+		}
+	}
+	return "", s
+}
+
+// parseDateRange parses an absolute date filter value into inclusive bounds, either of which may be nil.
+// Accepted forms: 2024-05-01, >2024-01, <=2024, 2024-01..2024-03, 2024-01.. and ..2024-03.
+func parseDateRange(s string) (after, before *time.Time, ok bool) {
+	if from, to, isRange := strings.Cut(s, ".."); isRange {
+		if from == "" && to == "" {
+			return nil, nil, false
+		}
+		if from != "" {
+			start, _, valid := parsePeriod(from)
+			if !valid {
+				return nil, nil, false
+			}
+			after = &start
+		}
+		if to != "" {
+			_, end, valid := parsePeriod(to)
+			if !valid {
+				return nil, nil, false
+			}
+			last := end.Add(-time.Second)
+			before = &last
+		}
+		return after, before, true
+	}
+
+	op, operand := splitComparison(s)
+	start, end, valid := parsePeriod(operand)
+	if !valid {
+		return nil, nil, false
+	}
+	last := end.Add(-time.Second)
+
+	switch op {
+	case ">":
+		return &end, nil, true
+	case ">=":
+		return &start, nil, true
+	case "<":
+		beforeStart := start.Add(-time.Second)
+		return nil, &beforeStart, true
+	case "<=":
+		return nil, &last, true
+	default:
+		return &start, &last, true
+	}
+}
+
+// parseAgeRange parses a relative age filter value into inclusive bounds, either of which may be nil.
+// A smaller age is more recent, so <7d means "within the last 7 days".
+// Accepted forms: <7d, >1y, 7d (same as <7d) and 1d..1w.
+func parseAgeRange(s string) (after, before *time.Time, ok bool) {
+	now := timeNow()
+
+	if from, to, isRange := strings.Cut(s, ".."); isRange {
+		youngest, okFrom := parseAge(from, now)
+		oldest, okTo := parseAge(to, now)
+		if !okFrom || !okTo {
+			return nil, nil, false
+		}
+		if youngest.Before(oldest) {
+			youngest, oldest = oldest, youngest
+		}
+		return &oldest, &youngest, true
+	}
+
+	op, operand := splitComparison(s)
+	t, valid := parseAge(operand, now)
+	if !valid {
+		return nil, nil, false
+	}
+
+	switch op {
+	case ">", ">=":
+		return nil, &t, true
+	default:
+		return &t, nil, true
+	}
+}
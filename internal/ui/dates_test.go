@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"testing"
+	"time"
+)
+
+func localTime(year int, month time.Month, day, hour, min, sec int) *time.Time {
+	t := time.Date(year, month, day, hour, min, sec, 0, time.Local)
+	return &t
+}
+
+func assertTimePtr(t *testing.T, label string, got, want *time.Time) {
+	t.Helper()
+	if (got == nil) != (want == nil) || (got != nil && !got.Equal(*want)) {
+		t.Errorf("%s mismatch: got %v, want %v", label, got, want)
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	tests := []struct {
+		input  string
+		after  *time.Time
+		before *time.Time
+		ok     bool
+	}{
+		{input: "2024-05-01", after: localTime(2024, 5, 1, 0, 0, 0), before: localTime(2024, 5, 1, 23, 59, 59), ok: true},
+		{input: "2024-02", after: localTime(2024, 2, 1, 0, 0, 0), before: localTime(2024, 2, 29, 23, 59, 59), ok: true},
+		{input: "2023", after: localTime(2023, 1, 1, 0, 0, 0), before: localTime(2023, 12, 31, 23, 59, 59), ok: true},
+		{input: ">2024-01", after: localTime(2024, 2, 1, 0, 0, 0), ok: true},
+		{input: ">=2024-01", after: localTime(2024, 1, 1, 0, 0, 0), ok: true},
+		{input: "<2024-01", before: localTime(2023, 12, 31, 23, 59, 59), ok: true},
+		{input: "<=2024-01", before: localTime(2024, 1, 31, 23, 59, 59), ok: true},
+		{input: "2024-01..2024-03", after: localTime(2024, 1, 1, 0, 0, 0), before: localTime(2024, 3, 31, 23, 59, 59), ok: true},
+		{input: "2024-01..", after: localTime(2024, 1, 1, 0, 0, 0), ok: true},
+		{input: "..2024-03", before: localTime(2024, 3, 31, 23, 59, 59), ok: true},
+		{input: "..", ok: false},
+		{input: "yesterday", ok: false},
+		{input: "2024-13", ok: false},
+		{input: "7d", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			after, before, ok := parseDateRange(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("ok mismatch: got %v, want %v", ok, tt.ok)
+			}
+			assertTimePtr(t, "after", after, tt.after)
+			assertTimePtr(t, "before", before, tt.before)
+		})
+	}
+}
+
+func TestParseAgeRange(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	weekAgo := now.AddDate(0, 0, -7)
+	dayAgo := now.AddDate(0, 0, -1)
+	twoMonthsAgo := now.AddDate(0, -2, 0)
+	sixHoursAgo := now.Add(-6 * time.Hour)
+
+	tests := []struct {
+		input  string
+		after  *time.Time
+		before *time.Time
+		ok     bool
+	}{
+		{input: "<7d", after: &weekAgo, ok: true},
+		{input: "7d", after: &weekAgo, ok: true},
+		{input: ">7d", before: &weekAgo, ok: true},
+		{input: "<6h", after: &sixHoursAgo, ok: true},
+		{input: ">=2mo", before: &twoMonthsAgo, ok: true},
+		{input: "1d..1w", after: &weekAgo, before: &dayAgo, ok: true},
+		{input: "1w..1d", after: &weekAgo, before: &dayAgo, ok: true},
+		{input: "<7x", ok: false},
+		{input: "<d", ok: false},
+		{input: "2024-01", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			after, before, ok := parseAgeRange(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("ok mismatch: got %v, want %v", ok, tt.ok)
+			}
+			assertTimePtr(t, "after", after, tt.after)
+			assertTimePtr(t, "before", before, tt.before)
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package ui
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mybooru/internal/models"
+)
+
+// FormatQuery renders a search query as its canonical query string, which ParseQuery turns back
+// into a query matching the same media. Queries that only differ in how they were written render
+// the same: terms are sorted and deduplicated, nested groups are flattened, double negations are
+// dropped, tag names are lowercased and filter values are spelled out, so "/rating:s Cat" and
+// "cat /rating:safe" both become "cat /rating:safe".
+//
+// Saved searches appear expanded and relative dates as the absolute times they resolved to.
+// Pagination and the fields set by the caller rather than the query string, such as Blacklist,
+// are left out. Tag aliases are not resolved, since only the database knows them, so a query
+// naming an alias and one naming its consequent match the same media but render differently.
+func FormatQuery(q *models.SearchQuery) string {
+	root := filterFields(q)
+	expr := normalizeNode(q.Expr)
+
+	// ParseQuery collects filters written among top-level terms into the root query, so a single
+	// filter node at the top can only be written that way
+	if len(formatFilters(root)) == 0 && expr != nil {
+		if expr.Kind == models.QueryNodeFilter {
+			root, expr = expr.Filter, nil
+		} else if expr.Kind == models.QueryNodeAnd {
+			if i, ok := singleFilter(expr.Children); ok {
+				root = expr.Children[i].Filter
+				rest := append(append([]*models.QueryNode(nil), expr.Children[:i]...), expr.Children[i+1:]...)
+				expr = joinNodes(models.QueryNodeAnd, rest)
+			}
+		}
+	}
+	rootFilters := formatFilters(root)
+
+	var parts []string
+	if expr != nil {
+		switch {
+		case expr.Kind == models.QueryNodeAnd:
+			parts = append(parts, formatSequence(expr.Children, false))
+		case expr.Kind == models.QueryNodeOr && len(rootFilters) == 0:
+			parts = append(parts, formatBranches(expr))
+		default:
+			parts = append(parts, formatTerm(expr))
+		}
+	}
+	parts = append(parts, rootFilters...)
+
+	if q.OrderBy != "" && (q.OrderBy != models.SortByID || q.OrderAsc) {
+		order := "/order:" + string(q.OrderBy)
+		if q.OrderAsc {
+			order += "_asc"
+		}
+		if q.OrderBy == models.SortByRandom && q.RandomSeed != 0 {
+			order += ":" + strconv.FormatInt(q.RandomSeed, 10)
+		}
+		parts = append(parts, order)
+	}
+	if q.IgnoreBlacklist {
+		parts = append(parts, "/blacklist:off")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// filterFields returns a copy of q holding only the conditions that filters can express
+func filterFields(q *models.SearchQuery) *models.SearchQuery {
+	return &models.SearchQuery{
+		Rating:        q.Rating,
+		MinWidth:      q.MinWidth,
+		MaxWidth:      q.MaxWidth,
+		MinHeight:     q.MinHeight,
+		MaxHeight:     q.MaxHeight,
+		MinFileSize:   q.MinFileSize,
+		MaxFileSize:   q.MaxFileSize,
+		MinDuration:   q.MinDuration,
+		MaxDuration:   q.MaxDuration,
+		MinRatio:      q.MinRatio,
+		MaxRatio:      q.MaxRatio,
+		MinMegapixels: q.MinMegapixels,
+		MaxMegapixels: q.MaxMegapixels,
+		TagCounts:     q.TagCounts,
+		HasParent:     q.HasParent,
+		ParentID:      q.ParentID,
+		IsFavorite:    q.IsFavorite,
+		CreatedAfter:  q.CreatedAfter,
+		CreatedBefore: q.CreatedBefore,
+		ViewedAfter:   q.ViewedAfter,
+		ViewedBefore:  q.ViewedBefore,
+		Viewed:        q.Viewed,
+		MediaTypes:    q.MediaTypes,
+		Extensions:    q.Extensions,
+		MinID:         q.MinID,
+		MaxID:         q.MaxID,
+		MD5s:          q.MD5s,
+		Codecs:        q.Codecs,
+		MimeTypes:     q.MimeTypes,
+	}
+}
+
+// normalizeNode rewrites an expression into its canonical shape, returning nil if nothing is left
+func normalizeNode(n *models.QueryNode) *models.QueryNode {
+	if n == nil {
+		return nil
+	}
+
+	switch n.Kind {
+	case models.QueryNodeTag, models.QueryNodeWildcard:
+		return &models.QueryNode{Kind: n.Kind, Value: asciiLower(n.Value)}
+	case models.QueryNodeFilter:
+		if n.Filter == nil || len(formatFilters(n.Filter)) == 0 {
+			return nil
+		}
+		return &models.QueryNode{Kind: n.Kind, Filter: filterFields(n.Filter)}
+	case models.QueryNodeNot:
+		if len(n.Children) == 0 {
+			return nil
+		}
+		child := normalizeNode(n.Children[0])
+		if child == nil {
+			return nil
+		}
+		if child.Kind == models.QueryNodeNot {
+			return child.Children[0]
+		}
+		return &models.QueryNode{Kind: n.Kind, Children: []*models.QueryNode{child}}
+	}
+
+	// Flatten nested groups of the same kind, then sort and deduplicate by rendering
+	var children []*models.QueryNode
+	for _, c := range n.Children {
+		c = normalizeNode(c)
+		if c == nil {
+			continue
+		}
+		if c.Kind == n.Kind {
+			children = append(children, c.Children...)
+		} else {
+			children = append(children, c)
+		}
+	}
+
+	keyed := make(map[string]*models.QueryNode, len(children))
+	keys := make([]string, 0, len(children))
+	for _, c := range children {
+		key := formatTerm(c)
+		if _, dup := keyed[key]; !dup {
+			keyed[key] = c
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	unique := make([]*models.QueryNode, 0, len(keys))
+	for _, key := range keys {
+		unique = append(unique, keyed[key])
+	}
+	return joinNodes(n.Kind, unique)
+}
+
+// singleFilter returns the index of the only filter node among nodes, if there is exactly one
+func singleFilter(nodes []*models.QueryNode) (int, bool) {
+	index := -1
+	for i, n := range nodes {
+		if n.Kind == models.QueryNodeFilter {
+			if index >= 0 {
+				return 0, false
+			}
+			index = i
+		}
+	}
+	return index, index >= 0
+}
+
+// formatBranches renders an OR as the operands of a top-level query or group
+func formatBranches(n *models.QueryNode) string {
+	branches := make([]string, 0, len(n.Children))
+	for _, c := range n.Children {
+		if c.Kind == models.QueryNodeAnd {
+			branches = append(branches, formatSequence(c.Children, true))
+		} else {
+			branches = append(branches, formatTerm(c))
+		}
+	}
+	return strings.Join(branches, " or ")
+}
+
+// formatSequence renders AND'ed terms. Where the parser would gather a sequence's filters into a
+// single filter node, one filter node can be written inline at the end; otherwise filter nodes
+// are grouped so that they stay separate.
+func formatSequence(nodes []*models.QueryNode, inlineFilter bool) string {
+	var terms []string
+	var inline []string
+	i, single := singleFilter(nodes)
+	for j, n := range nodes {
+		if inlineFilter && single && i == j {
+			inline = formatFilters(n.Filter)
+			continue
+		}
+		terms = append(terms, formatTerm(n))
+	}
+	return strings.Join(append(terms, inline...), " ")
+}
+
+// formatTerm renders a node as a single term of a sequence
+func formatTerm(n *models.QueryNode) string {
+	switch n.Kind {
+	case models.QueryNodeTag, models.QueryNodeWildcard:
+		// A bare "or" or "|" would be read as an operator
+		if strings.EqualFold(n.Value, "or") || n.Value == "|" {
+			return "(~" + n.Value + ")"
+		}
+		return n.Value
+	case models.QueryNodeNot:
+		return "-" + formatTerm(n.Children[0])
+	case models.QueryNodeFilter:
+		return "(" + strings.Join(formatFilters(n.Filter), " ") + ")"
+	case models.QueryNodeAnd:
+		return "(" + formatSequence(n.Children, true) + ")"
+	default:
+		return "(" + formatBranches(n) + ")"
+	}
+}
+
+// ratingNames and typeNames give the canonical order of rating and media type values
+var (
+	ratingNames = []models.Rating{models.RatingSafe, models.RatingQuestionable, models.RatingExplicit}
+	typeNames   = []models.MediaType{models.MediaTypeImage, models.MediaTypeVideo, models.MediaTypeAudio}
+)
+
+// formatFilters renders the conditions of a filter set as filter tokens in a fixed order
+func formatFilters(q *models.SearchQuery) []string {
+	var tokens []string
+	add := func(filter, value string) {
+		tokens = append(tokens, "/"+filter+":"+value)
+	}
+
+	if q.IsFavorite != nil {
+		add("favorite", strconv.FormatBool(*q.IsFavorite))
+	}
+	for _, r := range ratingNames {
+		if containsValue(q.Rating, r) {
+			add("rating", string(r))
+		}
+	}
+	for _, t := range typeNames {
+		if containsValue(q.MediaTypes, t) {
+			add("type", string(t))
+		}
+	}
+	for _, ext := range sortedUnique(q.Extensions) {
+		add("ext", ext)
+	}
+	if id, ok := formatIntRange(q.MinID, q.MaxID); ok {
+		add("id", id)
+	}
+	for _, hash := range sortedUnique(q.MD5s) {
+		add("md5", hash)
+	}
+	for _, codec := range sortedUnique(q.Codecs) {
+		add("codec", codec)
+	}
+	for _, mime := range sortedUnique(q.MimeTypes) {
+		add("mime", mime)
+	}
+
+	for _, bound := range []struct {
+		filter string
+		value  *int64
+	}{
+		{"minwidth", q.MinWidth}, {"maxwidth", q.MaxWidth},
+		{"minheight", q.MinHeight}, {"maxheight", q.MaxHeight},
+		{"minfilesize", q.MinFileSize}, {"maxfilesize", q.MaxFileSize},
+	} {
+		if bound.value != nil {
+			add(bound.filter, strconv.FormatInt(*bound.value, 10))
+		}
+	}
+
+	for _, value := range formatFloatRange(q.MinDuration, q.MaxDuration) {
+		add("duration", value)
+	}
+	for _, value := range formatFloatRange(q.MinRatio, q.MaxRatio) {
+		add("ratio", value)
+	}
+	for _, value := range formatFloatRange(q.MinMegapixels, q.MaxMegapixels) {
+		add("mpixels", value)
+	}
+
+	var counts []string
+	for _, tc := range q.TagCounts {
+		filter := tagCountFilterName(tc.Category)
+		if value, ok := formatIntRange(int64PtrFromInt(tc.Min), int64PtrFromInt(tc.Max)); ok && filter != "" {
+			counts = append(counts, "/"+filter+":"+value)
+		}
+	}
+	tokens = append(tokens, sortedUnique(counts)...)
+
+	if q.ParentID != nil {
+		add("parent", strconv.FormatInt(*q.ParentID, 10))
+	} else if q.HasParent != nil {
+		if *q.HasParent {
+			add("parent", "any")
+		} else {
+			add("parent", "none")
+		}
+	}
+
+	if value, ok := formatTimeRange(q.CreatedAfter, q.CreatedBefore); ok {
+		add("date", value)
+	}
+	if q.Viewed != nil {
+		if *q.Viewed {
+			add("viewed", "any")
+		} else {
+			add("viewed", "never")
+		}
+	}
+	if value, ok := formatTimeRange(q.ViewedAfter, q.ViewedBefore); ok {
+		add("viewed", value)
+	}
+
+	return tokens
+}
+
+// formatIntRange renders whole number bounds as a single range value. Parsing <0 yields a bound
+// of -1, which ranges can't express, so negative upper bounds are written that way instead.
+func formatIntRange(min, max *int64) (string, bool) {
+	if min != nil && *min < 0 {
+		min = nil
+	}
+	switch {
+	case max != nil && *max < 0:
+		return "<0", true
+	case min != nil && max != nil:
+		return strconv.FormatInt(*min, 10) + ".." + strconv.FormatInt(*max, 10), true
+	case min != nil:
+		return strconv.FormatInt(*min, 10) + "..", true
+	case max != nil:
+		return ".." + strconv.FormatInt(*max, 10), true
+	default:
+		return "", false
+	}
+}
+
+// formatFloatRange renders decimal bounds as range values, which unlike comparisons are parsed
+// exactly by every decimal filter. Equal bounds are written separately, since /duration: widens
+// a range with equal ends. Negative lower bounds can't be written and match like 0 anyway.
+func formatFloatRange(min, max *float64) []string {
+	format := func(v float64) string {
+		return strconv.FormatFloat(max0(v), 'f', -1, 64)
+	}
+	switch {
+	case min != nil && max != nil && *min < *max:
+		return []string{format(*min) + ".." + format(*max)}
+	case min != nil && max != nil:
+		return []string{format(*min) + "..", ".." + format(*max)}
+	case min != nil:
+		return []string{format(*min) + ".."}
+	case max != nil:
+		return []string{".." + format(*max)}
+	default:
+		return nil
+	}
+}
+
+func max0(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// formatTimeRange renders inclusive time bounds as a date range, using whole days where the
+// bounds fall on local day boundaries and timestamps otherwise
+func formatTimeRange(after, before *time.Time) (string, bool) {
+	if after == nil && before == nil {
+		return "", false
+	}
+
+	var from, to string
+	if after != nil {
+		t := after.In(time.Local)
+		if t.Equal(startOfDay(t)) {
+			from = t.Format("2006-01-02")
+		} else {
+			from = t.Format(timestampLayout)
+		}
+	}
+	if before != nil {
+		t := before.In(time.Local)
+		if next := t.Add(time.Second); next.Equal(startOfDay(next)) {
+			to = t.Format("2006-01-02")
+		} else {
+			to = t.Format(timestampLayout)
+		}
+	}
+	return from + ".." + to, true
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// tagCountFilterName returns the filter that bounds the tag count of a category
+func tagCountFilterName(category *models.TagCategory) string {
+	for name, c := range tagCountFilters {
+		if (c == nil) == (category == nil) && (c == nil || *c == *category) {
+			return name
+		}
+	}
+	return ""
+}
+
+func int64PtrFromInt(v *int) *int64 {
+	if v == nil {
+		return nil
+	}
+	n := int64(*v)
+	return &n
+}
+
+func containsValue[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedUnique returns the distinct values in ascending order
+func sortedUnique(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	unique := append([]string(nil), values...)
+	sort.Strings(unique)
+	n := 1
+	for _, v := range unique[1:] {
+		if v != unique[n-1] {
+			unique[n] = v
+			n++
+		}
+	}
+	return unique[:n]
+}
+
+// asciiLower lowercases ASCII letters only, matching SQLite's NOCASE and LIKE, which leave
+// other characters alone
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return r
+	}, s)
+}
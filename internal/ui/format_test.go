@@ -0,0 +1,82 @@
+package ui
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"mybooru/internal/ui/uitest"
+)
+
+func TestFormatQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: ""},
+		{query: "Cat /rating:s", want: "cat /rating:safe"},
+		{query: "dog cat cat", want: "cat dog"},
+		{query: "/rating:e /rating:s cat /type:video", want: "cat /rating:safe /rating:explicit /type:video"},
+		{query: "b | a", want: "a or b"},
+		{query: "~b ~a c", want: "(a or b) c"},
+		{query: "a (b (c d))", want: "a b c d"},
+		{query: "--cat", want: "cat"},
+		{query: "-(b a)", want: "-(a b)"},
+		{query: "cat /rating:s | dog", want: "cat /rating:safe or dog"},
+		{query: "(cat | dog) /rating:s", want: "(cat or dog) /rating:safe"},
+		{query: "cat (/rating:q) /rating:s", want: "(/rating:questionable) cat /rating:safe"},
+		{query: "-/rating:e", want: "-(/rating:explicit)"},
+		{query: "cat (~OR)", want: "(~or) cat"},
+		{query: "/order:filesize_asc /blacklist:off cat", want: "cat /order:filesize_asc /blacklist:off"},
+		{query: "/order:id cat", want: "cat"},
+		{query: "/codec:h265 /ext:.PNG /id:>9", want: "/ext:png /id:10.. /codec:hevc"},
+		{query: "/duration:30 /ratio:1..2 /mpixels:>=4", want: "/duration:29.5..30.5 /ratio:1..2 /mpixels:4.."},
+		{query: "/tagcount:<3 /arttags:0", want: "/arttags:0..0 /tagcount:..2"},
+		{query: "/date:2024-05", want: "/date:2024-05-01..2024-05-31"},
+		{query: "/date:>=2024-05-01T10:00:00Z", want: "/date:" + time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).In(time.Local).Format(timestampLayout) + ".."},
+		{query: "/viewed:never /parent:7", want: "/parent:7 /viewed:never"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, diagnostics := ParseQuery(tt.query)
+			if len(diagnostics) != 0 {
+				t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+			}
+			if got := FormatQuery(q); got != tt.want {
+				t.Errorf("FormatQuery(ParseQuery(%q)) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// Vocabulary of the random queries FormatQuery is tested with
+var (
+	randomQueryTags    = []string{"cat", "Dog", "fox", "blue_hair", "cat_(cosplay)", "ねこ", "blue_*", "*_hair"}
+	randomQueryFilters = []string{
+		"/rating:s", "/rating:questionable", "/type:video", "/favorite:true", "/minwidth:100",
+		"/maxfilesize:2048", "/tagcount:2..3", "/gentags:<2", "/ext:PNG", "/id:>3", "/id:5",
+		"/md5:0123456789ABCDEF0123456789ABCDEF", "/codec:h265", "/mime:image/png",
+		"/duration:0", "/duration:1m..5m", "/ratio:>1", "/ratio:16:9", "/mpixels:..2",
+		"/date:2024", "/date:>2023-06-15", "/age:<7d", "/viewed:never", "/viewed:>1w",
+		"/parent:none", "/parent:3", "/order:filesize_asc", "/order:id", "/blacklist:off",
+	}
+)
+
+func TestFormatQueryIsCanonical(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 5000; i++ {
+		query := uitest.RandomQuery(rng, 3, randomQueryTags, randomQueryFilters)
+		q, _ := ParseQuery(query)
+		formatted := FormatQuery(q)
+
+		reparsed, diagnostics := ParseQuery(formatted)
+		if len(diagnostics) != 0 {
+			t.Fatalf("%q formatted as %q, which has diagnostics: %+v", query, formatted, diagnostics)
+		}
+		if again := FormatQuery(reparsed); again != formatted {
+			t.Fatalf("formatting is not stable for %q:\nfirst:  %q\nsecond: %q", query, formatted, again)
+		}
+	}
+}
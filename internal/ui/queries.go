@@ -1,36 +1,529 @@
 package ui
 
 import (
+	"fmt"
 	"mybooru/internal/models"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// parser is a recursive descent parser for the search query grammar:
+//
+//	query   := or
+//	or      := and (("or" | "|") and)*
+//	and     := ["-" | "~"] unary ...
+//	unary   := "-" unary | "(" or ")" | "/saved:" name | "/" filter | tag
+//
+// Terms in a sequence are AND'ed, "~" terms in the same sequence are OR'ed together,
+// and plain filters in a sequence are collected into a single set of conditions.
 type parser struct {
-	query []rune
-	pos   int
+	query  []rune
+	pos    int
+	depth  int                 // Number of currently open groups
+	global *models.SearchQuery // Query-wide settings such as ordering
+
+	resolve   SavedSearchResolver // Looks up /saved: names, nil if saved searches are unavailable
+	expanding []string            // Saved searches currently being expanded, to catch self references
+
+	terms     []TagTerm // Plain tag terms in the order they were written
+	negations int       // Number of '-' enclosing the current position
+
+	diagnostics []models.QueryDiagnostic
+}
+
+// TagTerm is a plain tag term as written in a query
+type TagTerm struct {
+	Name    string
+	Offset  int  // Rune offset of the term in the query
+	Length  int  // Length of the term in runes
+	Negated bool // Whether the term excludes media, being under an odd number of '-'
 }
 
+// SavedSearchResolver returns the query text of the saved search with the given name
+type SavedSearchResolver func(name string) (string, bool)
+
+// savedSearchPrefix introduces a reference to a saved search, which is expanded inline
+const savedSearchPrefix = "/saved:"
+
 // parseTag assumes the parser position is on the first character of a word (after a space or modifier char).
 // It will iterate through the string until a whitespace or the end of the string is reached,
-// returning the complete word.
+// returning the complete word. Inside a group, an unbalanced ')' also ends the word so that
+// tags such as cat_(cosplay) keep their parentheses.
 func (p *parser) parseTag() string {
 	startPos := p.pos
+	balance := 0
 	for p.pos < len(p.query) {
 		c := p.query[p.pos]
 		if isWhitespace(c) {
-			result := string(p.query[startPos:p.pos])
-			p.pos++ // Move past the terminating whitespace
-			return result
+			break
+		}
+		if c == '(' {
+			balance++
+		} else if c == ')' {
+			if balance == 0 && p.depth > 0 {
+				break
+			}
+			balance--
 		}
 		p.pos++
 	}
 	return string(p.query[startPos:p.pos])
 }
 
+func (p *parser) skipWhitespace() {
+	for p.pos < len(p.query) && isWhitespace(p.query[p.pos]) {
+		p.pos++
+	}
+}
+
+// atGroupEnd reports whether the parser is on the ')' closing the current group
+func (p *parser) atGroupEnd() bool {
+	return p.depth > 0 && p.pos < len(p.query) && p.query[p.pos] == ')'
+}
+
+// atOr reports whether the parser is on an "or" or "|" operator, returning its length in runes.
+// The operator has to stand alone: followed by whitespace, '(', the end of the query or, inside
+// a group, the closing ')'.
+func (p *parser) atOr() (int, bool) {
+	n := 0
+	if p.pos < len(p.query) && p.query[p.pos] == '|' {
+		n = 1
+	} else if p.pos+1 < len(p.query) && strings.EqualFold(string(p.query[p.pos:p.pos+2]), "or") {
+		n = 2
+	} else {
+		return 0, false
+	}
+
+	end := p.pos + n
+	if end < len(p.query) && !isWhitespace(p.query[end]) && p.query[end] != '(' && !(p.depth > 0 && p.query[end] == ')') {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseOr parses a sequence of AND'ed terms separated by "or" operators.
+// It returns one branch per operand so that the caller can decide where filters end up.
+//
+// An operator with nothing written on one side is reported and otherwise ignored. The word "or"
+// is always taken as an operator, so a tag named "or" has to be written as (~or).
+func (p *parser) parseOr() []branch {
+	var branches []branch
+	prevOp, prevOpEnd := -1, -1 // The operator before the current operand, if any
+	prevReported := false
+	for {
+		p.skipWhitespace()
+		start := p.pos
+		b := p.parseAnd()
+		if len(b.terms) > 0 || b.filters != nil {
+			branches = append(branches, b)
+		}
+		empty := p.pos == start
+
+		p.skipWhitespace()
+		n, ok := p.atOr()
+		switch {
+		case empty && ok:
+			p.danglingOr(p.pos, p.pos+n)
+		case empty && prevOp >= 0 && !prevReported:
+			p.danglingOr(prevOp, prevOpEnd)
+		}
+		if !ok {
+			return branches
+		}
+		prevOp, prevOpEnd, prevReported = p.pos, p.pos+n, empty
+		p.pos += n
+	}
+}
+
+// danglingOr reports the operator spanning the runes [start, end) for missing an operand
+func (p *parser) danglingOr(start, end int) {
+	op := string(p.query[start:end])
+	message := fmt.Sprintf("%q needs a term on each side", op)
+	if op != "|" {
+		message += "; write (~or) to search for a tag named or"
+	}
+	p.addDiagnosticSpan(start, end, message, "")
+}
+
+// branch is one operand of an OR: its terms plus the filters that were written inline
+type branch struct {
+	terms   []*models.QueryNode
+	filters *models.SearchQuery
+}
+
+// node folds the branch into a single expression, wrapping its filters in a filter node
+func (b branch) node() *models.QueryNode {
+	terms := b.terms
+	if b.filters != nil {
+		terms = append(terms, &models.QueryNode{Kind: models.QueryNodeFilter, Filter: b.filters})
+	}
+	return joinNodes(models.QueryNodeAnd, terms)
+}
+
+// parseAnd parses terms until the end of the query, the end of the current group or an "or" operator
+func (p *parser) parseAnd() branch {
+	var b branch
+	var optional []*models.QueryNode
+
+	for {
+		p.skipWhitespace()
+		if p.pos >= len(p.query) || p.atGroupEnd() {
+			break
+		}
+		if _, ok := p.atOr(); ok {
+			break
+		}
+
+		c := p.query[p.pos]
+		if c == '~' {
+			p.pos++
+			if node := p.parseUnary(); node != nil {
+				optional = append(optional, node)
+			}
+		} else if c == '/' && !p.atSavedSearch() {
+			p.pos++
+			if b.filters == nil {
+				b.filters = &models.SearchQuery{}
+			}
+			p.addFilter(b.filters)
+		} else if node := p.parseUnary(); node != nil {
+			b.terms = append(b.terms, node)
+		}
+	}
+
+	if b.filters != nil && isEmptyFilter(b.filters) {
+		b.filters = nil
+	}
+	if len(optional) > 0 {
+		b.terms = append(b.terms, joinNodes(models.QueryNodeOr, optional))
+	}
+	return b
+}
+
+// parseUnary parses a single, possibly negated, term, group or filter.
+// Returns nil if nothing was parsed (e.g. a lone '-').
+func (p *parser) parseUnary() *models.QueryNode {
+	if p.pos >= len(p.query) {
+		return nil
+	}
+
+	switch p.query[p.pos] {
+	case '-':
+		p.pos++
+		p.negations++
+		child := p.parseUnary()
+		p.negations--
+		if child == nil {
+			return nil
+		}
+		return &models.QueryNode{Kind: models.QueryNodeNot, Children: []*models.QueryNode{child}}
+	case '~':
+		// Optional markers are only meaningful directly inside a term sequence
+		p.pos++
+		return p.parseUnary()
+	case ')':
+		// Inside a group the ')' closes it and never gets here
+		if p.depth == 0 {
+			start := p.pos
+			p.pos++
+			p.addDiagnostic(start, "unmatched ')'", "")
+			return nil
+		}
+	case '(':
+		groupStart := p.pos
+		p.pos++
+		p.depth++
+		var children []*models.QueryNode
+		for _, b := range p.parseOr() {
+			children = append(children, b.node())
+		}
+		if p.atGroupEnd() {
+			p.pos++
+		} else {
+			p.addDiagnostic(groupStart, "missing closing ')' for group", string(p.query[groupStart:p.pos])+")")
+		}
+		p.depth--
+		return joinNodes(models.QueryNodeOr, children)
+	case '/':
+		if p.atSavedSearch() {
+			return p.parseSavedSearch()
+		}
+		p.pos++
+		filters := &models.SearchQuery{}
+		p.addFilter(filters)
+		if isEmptyFilter(filters) {
+			return nil
+		}
+		return &models.QueryNode{Kind: models.QueryNodeFilter, Filter: filters}
+	}
+
+	tagStart := p.pos
+	tag := p.parseTag()
+	if tag == "" {
+		return nil
+	}
+	if isWildcard(tag) {
+		return &models.QueryNode{Kind: models.QueryNodeWildcard, Value: tag}
+	}
+	p.terms = append(p.terms, TagTerm{Name: tag, Offset: tagStart, Length: p.pos - tagStart, Negated: p.negations%2 == 1})
+	return &models.QueryNode{Kind: models.QueryNodeTag, Value: tag}
+}
+
+// atSavedSearch reports whether the parser is on a /saved:name reference
+func (p *parser) atSavedSearch() bool {
+	end := p.pos + len(savedSearchPrefix)
+	return end <= len(p.query) && string(p.query[p.pos:end]) == savedSearchPrefix
+}
+
+// parseSavedSearch expands a /saved:name reference into the expression of the saved query.
+// The saved query's /order: is used only if the outer query doesn't set one, and its
+// /blacklist:off carries over to the outer query.
+func (p *parser) parseSavedSearch() *models.QueryNode {
+	tokenStart := p.pos
+	p.pos += len(savedSearchPrefix)
+	name := p.parseTag()
+
+	if name == "" {
+		p.addDiagnostic(tokenStart, "missing saved search name", "")
+		return nil
+	}
+	if p.resolve == nil {
+		p.addDiagnostic(tokenStart, "saved searches cannot be used here", "")
+		return nil
+	}
+	for _, expanding := range p.expanding {
+		if strings.EqualFold(expanding, name) {
+			p.addDiagnostic(tokenStart, fmt.Sprintf("saved search %q refers to itself", name), "")
+			return nil
+		}
+	}
+
+	text, ok := p.resolve(name)
+	if !ok {
+		p.addDiagnostic(tokenStart, fmt.Sprintf("unknown saved search %q", name), "")
+		return nil
+	}
+
+	sub := &parser{
+		query:     []rune(text),
+		global:    &models.SearchQuery{},
+		resolve:   p.resolve,
+		expanding: append(append([]string(nil), p.expanding...), name),
+	}
+	var children []*models.QueryNode
+	for _, b := range sub.parseOr() {
+		children = append(children, b.node())
+	}
+
+	// Offsets inside the saved query are meaningless to the user, so report problems on the reference
+	for _, d := range sub.diagnostics {
+		p.addDiagnostic(tokenStart, fmt.Sprintf("in saved search %q: %s", name, d.Message), "")
+	}
+	if p.global.OrderBy == "" && sub.global.OrderBy != "" {
+		p.global.OrderBy = sub.global.OrderBy
+		p.global.OrderAsc = sub.global.OrderAsc
+		p.global.RandomSeed = sub.global.RandomSeed
+	}
+	if sub.global.IgnoreBlacklist {
+		p.global.IgnoreBlacklist = true
+	}
+
+	return joinNodes(models.QueryNodeOr, children)
+}
+
+// joinNodes combines nodes under an AND or OR, collapsing trivial cases
+func joinNodes(kind models.QueryNodeKind, nodes []*models.QueryNode) *models.QueryNode {
+	switch len(nodes) {
+	case 0:
+		return nil
+	case 1:
+		return nodes[0]
+	default:
+		return &models.QueryNode{Kind: kind, Children: nodes}
+	}
+}
+
+// isEmptyFilter reports whether no filter condition was set on q,
+// which happens when every filter in a sequence was invalid or query-wide (like /order:)
+func isEmptyFilter(q *models.SearchQuery) bool {
+	return reflect.ValueOf(*q).IsZero()
+}
+
+// isMD5 reports whether s is a lowercase hex MD5 hash
+func isMD5(s string) bool {
+	if len(s) != 32 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// isWildcard reports whether a search term is a glob pattern such as artist_* or *_hair
+func isWildcard(term string) bool {
+	return strings.ContainsRune(term, '*')
+}
+
+// orderFields maps the names accepted by /order: to sort fields
+var orderFields = map[string]models.SortField{
+	"id":         models.SortByID,
+	"filesize":   models.SortByFileSize,
+	"size":       models.SortByFileSize,
+	"width":      models.SortByWidth,
+	"height":     models.SortByHeight,
+	"mpixels":    models.SortByPixels,
+	"pixels":     models.SortByPixels,
+	"duration":   models.SortByDuration,
+	"tagcount":   models.SortByTagCount,
+	"viewed":     models.SortByLastViewed,
+	"lastviewed": models.SortByLastViewed,
+	"updated":    models.SortByUpdated,
+	"random":     models.SortByRandom,
+}
+
+// maxRandomSeed is the largest seed accepted by /order:random:<seed>, one less than the prime the
+// database scrambles IDs with
+const maxRandomSeed = 1<<31 - 2
+
+// orderValues lists the accepted /order: values, for diagnostics
+func orderValues() []string {
+	names := make([]string, 0, len(orderFields))
+	for name := range orderFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseOrder parses an /order: modifier such as "filesize" or "filesize_asc".
+// Orders are descending unless suffixed with _asc.
+func parseOrder(modifier string) (models.SortField, bool, bool) {
+	asc := false
+	if name, ok := strings.CutSuffix(modifier, "_asc"); ok {
+		modifier = name
+		asc = true
+	} else if name, ok := strings.CutSuffix(modifier, "_desc"); ok {
+		modifier = name
+	}
+
+	field, ok := orderFields[modifier]
+	return field, asc, ok
+}
+
+// filterNames lists every filter understood by addFilter, used to suggest fixes for typos
+var filterNames = []string{
+	"favorite", "minwidth", "maxwidth", "minheight", "maxheight", "minfilesize", "maxfilesize",
+	"rating", "type", "ext", "id", "md5", "codec", "mime", "order", "parent", "date", "age", "viewed",
+	"duration", "ratio", "mpixels",
+	"tagcount", "gentags", "arttags", "copytags", "chartags", "metatags",
+	"saved", "blacklist",
+}
+
+// codecAliases maps common alternative codec names to the names ffprobe reports
+var codecAliases = map[string]string{
+	"h265": "hevc",
+	"x265": "hevc",
+	"avc":  "h264",
+	"x264": "h264",
+}
+
+// tagCountFilters maps each tag-count filter to the category it counts, nil meaning all tags
+var tagCountFilters = map[string]*models.TagCategory{
+	"tagcount": nil,
+	"gentags":  categoryPtr(models.TagCategoryGeneral),
+	"arttags":  categoryPtr(models.TagCategoryArtist),
+	"copytags": categoryPtr(models.TagCategoryCopyright),
+	"chartags": categoryPtr(models.TagCategoryCharacter),
+	"metatags": categoryPtr(models.TagCategoryMetadata),
+}
+
+func categoryPtr(c models.TagCategory) *models.TagCategory {
+	return &c
+}
+
+var (
+	favoriteValues  = []string{"true", "false"}
+	blacklistValues = []string{"on", "off"}
+	ratingValues    = []string{"safe", "questionable", "explicit", "s", "q", "e"}
+	typeValues      = []string{"image", "video", "audio"}
+	parentValues    = []string{"none", "any", "true", "false"}
+)
+
+const (
+	dateHint = "expected a date like 2024-05-01, >2024-01 or 2024-01..2024-03"
+	ageHint  = "expected an age like <7d, >1y or 1d..2w"
+
+	durationHint = "expected a duration like >30s, 1m..5m or 90"
+	ratioHint    = "expected an aspect ratio like 16:9, >1 or 1.5..2"
+	numberHint   = "expected a number like >4, <=2 or 1..8"
+	idHint       = "expected an ID like 123, >1000 or 100..200"
+	countHint    = "expected a count like 0, <3, >=1 or 2..5"
+)
+
+// addDiagnostic records a problem with the token spanning the runes [start, p.pos)
+func (p *parser) addDiagnostic(start int, message, suggestion string) {
+	p.addDiagnosticSpan(start, p.pos, message, suggestion)
+}
+
+// addDiagnosticSpan records a problem with the token spanning the runes [start, end)
+func (p *parser) addDiagnosticSpan(start, end int, message, suggestion string) {
+	p.diagnostics = append(p.diagnostics, models.QueryDiagnostic{
+		Offset:     start,
+		Length:     end - start,
+		Token:      string(p.query[start:end]),
+		Message:    message,
+		Suggestion: suggestion,
+	})
+}
+
+// invalidValue records a diagnostic for a filter value, suggesting the closest accepted value if there is one
+func (p *parser) invalidValue(start int, filter, modifier string, options []string) {
+	message := fmt.Sprintf("invalid value %q for /%s", modifier, filter)
+	if len(options) > 0 {
+		message += fmt.Sprintf(", expected one of: %s", strings.Join(options, ", "))
+	}
+
+	suggestion := ""
+	if match, ok := closestMatch(modifier, options); ok {
+		suggestion = "/" + filter + ":" + match
+	}
+	p.addDiagnostic(start, message, suggestion)
+}
+
+// setTimeBounds overwrites whichever bounds a date filter specified, so that
+// /date:>2024 /date:<2025 combine into a single range
+func setTimeBounds(after, before **time.Time, newAfter, newBefore *time.Time) {
+	if newAfter != nil {
+		*after = newAfter
+	}
+	if newBefore != nil {
+		*before = newBefore
+	}
+}
+
+// setFloatBounds overwrites whichever bounds a range filter specified
+func setFloatBounds(min, max **float64, newMin, newMax *float64) {
+	if newMin != nil {
+		*min = newMin
+	}
+	if newMax != nil {
+		*max = newMax
+	}
+}
+
 // addFilter takes a string and attempts to parse out a SearchQuery filter condition to be added to the query.
-// Automatically modifies the query passed as a parameter, fails silently if syntax is invalid.
+// Automatically modifies the query passed as a parameter. Unknown filters and invalid values are ignored
+// and reported as diagnostics.
 // If a query defines the same filter multiple times, the later filter will overwrite the previous one.
 func (p *parser) addFilter(q *models.SearchQuery) {
+	tokenStart := p.pos - 1 // Include the leading '/'
 	startPos := p.pos
 	var filter string
 	var modifier string
@@ -42,9 +535,8 @@ func (p *parser) addFilter(q *models.SearchQuery) {
 			p.pos++
 			modifier = p.parseTag()
 			break
-		} else if isWhitespace(c) {
+		} else if isWhitespace(c) || p.atGroupEnd() {
 			filter = string(p.query[startPos:p.pos])
-			p.pos++
 			break
 		}
 		p.pos++
@@ -52,62 +544,64 @@ func (p *parser) addFilter(q *models.SearchQuery) {
 	if filter == "" && startPos < p.pos {
 		filter = string(p.query[startPos:p.pos])
 	}
+
+	parseNumber := func() (int64, bool) {
+		num, err := strconv.ParseInt(modifier, 10, 64)
+		if err != nil {
+			p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /%s, expected a whole number", modifier, filter), "")
+			return 0, false
+		}
+		return num, true
+	}
+
 	switch filter {
 	case "favorite":
-		var val bool
-		if modifier == "true" {
-			val = true
-		} else if modifier == "false" {
-			val = false
+		{
+			if modifier == "true" {
+				val := true
+				q.IsFavorite = &val
+			} else if modifier == "false" {
+				val := false
+				q.IsFavorite = &val
+			} else {
+				p.invalidValue(tokenStart, filter, modifier, favoriteValues)
+			}
 		}
-		q.IsFavorite = &val
 	case "minwidth":
 		{
-			num, err := strconv.ParseInt(modifier, 10, 64)
-			if err != nil {
-				return
+			if num, ok := parseNumber(); ok {
+				q.MinWidth = &num
 			}
-			q.MinWidth = &num
 		}
 	case "maxwidth":
 		{
-			num, err := strconv.ParseInt(modifier, 10, 64)
-			if err != nil {
-				return
+			if num, ok := parseNumber(); ok {
+				q.MaxWidth = &num
 			}
-			q.MaxWidth = &num
 		}
 	case "minheight":
 		{
-			num, err := strconv.ParseInt(modifier, 10, 64)
-			if err != nil {
-				return
+			if num, ok := parseNumber(); ok {
+				q.MinHeight = &num
 			}
-			q.MinHeight = &num
 		}
 	case "maxheight":
 		{
-			num, err := strconv.ParseInt(modifier, 10, 64)
-			if err != nil {
-				return
+			if num, ok := parseNumber(); ok {
+				q.MaxHeight = &num
 			}
-			q.MaxHeight = &num
 		}
 	case "minfilesize":
 		{
-			num, err := strconv.ParseInt(modifier, 10, 64)
-			if err != nil {
-				return
+			if num, ok := parseNumber(); ok {
+				q.MinFileSize = &num
 			}
-			q.MinFileSize = &num
 		}
 	case "maxfilesize":
 		{
-			num, err := strconv.ParseInt(modifier, 10, 64)
-			if err != nil {
-				return
+			if num, ok := parseNumber(); ok {
+				q.MaxFileSize = &num
 			}
-			q.MaxFileSize = &num
 		}
 	case "rating":
 		{
@@ -117,6 +611,8 @@ func (p *parser) addFilter(q *models.SearchQuery) {
 				q.Rating = append(q.Rating, models.RatingQuestionable)
 			} else if modifier == "explicit" || modifier == "e" {
 				q.Rating = append(q.Rating, models.RatingExplicit)
+			} else {
+				p.invalidValue(tokenStart, filter, modifier, ratingValues)
 			}
 		}
 	case "type":
@@ -127,8 +623,83 @@ func (p *parser) addFilter(q *models.SearchQuery) {
 				q.MediaTypes = append(q.MediaTypes, models.MediaTypeVideo)
 			} else if modifier == "audio" {
 				q.MediaTypes = append(q.MediaTypes, models.MediaTypeAudio)
+			} else {
+				p.invalidValue(tokenStart, filter, modifier, typeValues)
 			}
 		}
+	case "ext":
+		{
+			ext := strings.ToLower(strings.TrimPrefix(modifier, "."))
+			if ext == "" {
+				p.addDiagnostic(tokenStart, "missing value for /ext, expected a file extension such as png", "")
+				return
+			}
+			q.Extensions = append(q.Extensions, ext)
+		}
+	case "id":
+		{
+			min, max, ok := parseRange(modifier, parseID, 1)
+			if !ok {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /id, %s", modifier, idHint), "")
+				return
+			}
+			q.MinID = int64Ptr(min)
+			q.MaxID = int64Ptr(max)
+		}
+	case "md5":
+		{
+			// Accept a file name as well, since hashes are usually copied from one
+			hash := strings.ToLower(strings.TrimSuffix(modifier, filepath.Ext(modifier)))
+			if !isMD5(hash) {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /md5, expected a 32 character hex hash", modifier), "")
+				return
+			}
+			q.MD5s = append(q.MD5s, hash)
+		}
+	case "codec":
+		{
+			codec := strings.ToLower(modifier)
+			if codec == "" {
+				p.addDiagnostic(tokenStart, "missing value for /codec, expected a codec such as h264 or vp9", "")
+				return
+			}
+			if alias, ok := codecAliases[codec]; ok {
+				codec = alias
+			}
+			q.Codecs = append(q.Codecs, codec)
+		}
+	case "mime":
+		{
+			mime := strings.ToLower(modifier)
+			if !strings.Contains(mime, "/") {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /mime, expected a MIME type such as video/hevc", modifier), "")
+				return
+			}
+			q.MimeTypes = append(q.MimeTypes, mime)
+		}
+	case "order":
+		{
+			order, seed, isSeeded := strings.Cut(modifier, ":")
+			field, asc, ok := parseOrder(order)
+			if !ok || (isSeeded && field != models.SortByRandom) {
+				p.invalidValue(tokenStart, filter, modifier, orderValues())
+				return
+			}
+
+			var randomSeed int64
+			if isSeeded {
+				v, err := strconv.ParseUint(seed, 10, 64)
+				if err != nil || v == 0 || v > maxRandomSeed {
+					p.addDiagnostic(tokenStart, fmt.Sprintf("invalid seed %q for /order:random, expected a number from 1 to %d", seed, maxRandomSeed), "")
+					return
+				}
+				randomSeed = int64(v)
+			}
+
+			p.global.OrderBy = field
+			p.global.OrderAsc = asc
+			p.global.RandomSeed = randomSeed
+		}
 	case "parent":
 		{
 			if modifier == "none" || modifier == "false" {
@@ -137,57 +708,236 @@ func (p *parser) addFilter(q *models.SearchQuery) {
 			} else if modifier == "any" || modifier == "true" {
 				val := true
 				q.HasParent = &val
+			} else if num, err := strconv.ParseInt(modifier, 10, 64); err == nil {
+				q.ParentID = &num
+				val := true
+				q.HasParent = &val
+			} else {
+				p.invalidValue(tokenStart, filter, modifier, parentValues)
+			}
+		}
+	case "date":
+		{
+			after, before, ok := parseDateRange(modifier)
+			if !ok {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /date, %s", modifier, dateHint), "")
+				return
+			}
+			setTimeBounds(&q.CreatedAfter, &q.CreatedBefore, after, before)
+		}
+	case "age":
+		{
+			after, before, ok := parseAgeRange(modifier)
+			if !ok {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /age, %s", modifier, ageHint), "")
+				return
+			}
+			setTimeBounds(&q.CreatedAfter, &q.CreatedBefore, after, before)
+		}
+	case "viewed":
+		{
+			if modifier == "never" {
+				val := false
+				q.Viewed = &val
+				return
+			} else if modifier == "any" {
+				val := true
+				q.Viewed = &val
+				return
+			}
+
+			after, before, ok := parseAgeRange(modifier)
+			if !ok {
+				after, before, ok = parseDateRange(modifier)
+			}
+			if !ok {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /viewed, %s, %s, never or any", modifier, dateHint, ageHint), "")
+				return
+			}
+			setTimeBounds(&q.ViewedAfter, &q.ViewedBefore, after, before)
+		}
+	case "duration":
+		{
+			min, max, ok := parseDurationRange(modifier)
+			if !ok {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /duration, %s", modifier, durationHint), "")
+				return
+			}
+			setFloatBounds(&q.MinDuration, &q.MaxDuration, min, max)
+		}
+	case "ratio":
+		{
+			min, max, ok := parseRatioRange(modifier)
+			if !ok {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /ratio, %s", modifier, ratioHint), "")
+				return
+			}
+			setFloatBounds(&q.MinRatio, &q.MaxRatio, min, max)
+		}
+	case "mpixels":
+		{
+			min, max, ok := parseRange(modifier, parseDecimal, 0)
+			if !ok {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /mpixels, %s", modifier, numberHint), "")
+				return
+			}
+			setFloatBounds(&q.MinMegapixels, &q.MaxMegapixels, min, max)
+		}
+	case "tagcount", "gentags", "arttags", "copytags", "chartags", "metatags":
+		{
+			min, max, ok := parseRange(modifier, parseWholeNumber, 1)
+			if !ok {
+				p.addDiagnostic(tokenStart, fmt.Sprintf("invalid value %q for /%s, %s", modifier, filter, countHint), "")
+				return
+			}
+			q.TagCounts = append(q.TagCounts, models.TagCountFilter{
+				Category: tagCountFilters[filter],
+				Min:      intPtr(min),
+				Max:      intPtr(max),
+			})
+		}
+	case "blacklist":
+		{
+			if modifier == "off" {
+				p.global.IgnoreBlacklist = true
+			} else if modifier == "on" {
+				p.global.IgnoreBlacklist = false
 			} else {
-				if num, err := strconv.ParseInt(modifier, 10, 64); err == nil {
-					q.ParentID = &num
-					val := true
-					q.HasParent = &val
+				p.invalidValue(tokenStart, filter, modifier, blacklistValues)
+			}
+		}
+	case "saved":
+		{
+			p.addDiagnostic(tokenStart, "missing saved search name, expected /saved:name", "")
+		}
+	default:
+		{
+			suggestion := ""
+			if match, ok := closestMatch(filter, filterNames); ok {
+				suggestion = "/" + match
+				if modifier != "" {
+					suggestion += ":" + modifier
 				}
 			}
+			p.addDiagnostic(tokenStart, fmt.Sprintf("unknown filter /%s", filter), suggestion)
 		}
 	}
 }
 
 // ParseQuery takes a user generated string and transforms it into a SearchQuery struct.
-func ParseQuery(query string) *models.SearchQuery {
-	var searchQuery = &models.SearchQuery{}
-	p := &parser{query: []rune(query), pos: 0}
+// Problems that were skipped over while parsing are returned as diagnostics.
+// /saved: references are reported as unavailable; use ParseQueryWithSavedSearches to expand them.
+func ParseQuery(query string) (*models.SearchQuery, []models.QueryDiagnostic) {
+	return ParseQueryWithSavedSearches(query, nil)
+}
+
+// ParseQueryWithSavedSearches is ParseQuery with /saved:name references expanded through resolve
+func ParseQueryWithSavedSearches(query string, resolve SavedSearchResolver) (*models.SearchQuery, []models.QueryDiagnostic) {
+	p := &parser{query: []rune(query), global: &models.SearchQuery{}, resolve: resolve}
+
+	branches := p.parseOr()
 
-	if len(query) <= 0 {
-		return searchQuery
+	var searchQuery *models.SearchQuery
+	if len(branches) == 1 {
+		// Without a top-level OR, the inline filters apply to the whole query
+		searchQuery = branches[0].filters
+		if searchQuery == nil {
+			searchQuery = &models.SearchQuery{}
+		}
+		searchQuery.Expr = joinNodes(models.QueryNodeAnd, branches[0].terms)
+	} else {
+		searchQuery = &models.SearchQuery{}
+		var children []*models.QueryNode
+		for _, b := range branches {
+			children = append(children, b.node())
+		}
+		searchQuery.Expr = joinNodes(models.QueryNodeOr, children)
 	}
 
-	for p.pos < len(p.query) {
-		c := p.query[p.pos]
+	searchQuery.OrderBy = p.global.OrderBy
+	searchQuery.OrderAsc = p.global.OrderAsc
+	searchQuery.RandomSeed = p.global.RandomSeed
+	searchQuery.IgnoreBlacklist = p.global.IgnoreBlacklist
 
-		if isWhitespace(c) {
-			p.pos++
-			continue
-		} else if c == '-' {
-			p.pos++
-			tag := p.parseTag()
-			searchQuery.ExcludeTags = append(searchQuery.ExcludeTags, tag)
-			continue
-		} else if c == '~' {
-			p.pos++
-			tag := p.parseTag()
-			searchQuery.OptionalTags = append(searchQuery.OptionalTags, tag)
-			continue
-		} else if c == '/' {
-			p.pos++
-			p.addFilter(searchQuery)
-			continue
-		} else if c == '*' {
-			p.pos++
-			tag := p.parseTag()
-			searchQuery.WildcardTags = append(searchQuery.WildcardTags, tag)
-			continue
-		} else {
-			tag := p.parseTag()
-			searchQuery.IncludeTags = append(searchQuery.IncludeTags, tag)
-			continue
+	return searchQuery, p.diagnostics
+}
+
+// ParseTagTerms lists the plain tag terms of a query in the order they were written, leaving out
+// wildcards and the contents of saved searches
+func ParseTagTerms(query string) []TagTerm {
+	p := &parser{query: []rune(query), global: &models.SearchQuery{}}
+	p.parseOr()
+	return p.terms
+}
+
+// ParseBlacklist parses blacklist entries into a single expression matching the media any of them
+// would hide. Each entry uses the query syntax, so "spider -cartoon" hides spiders that aren't cartoons.
+// Blank entries are skipped, and the expression is nil if nothing is blacklisted.
+func ParseBlacklist(entries []string) (*models.QueryNode, []models.QueryDiagnostic) {
+	var nodes []*models.QueryNode
+	var diagnostics []models.QueryDiagnostic
+
+	for _, entry := range entries {
+		p := &parser{query: []rune(entry), global: &models.SearchQuery{}}
+		var children []*models.QueryNode
+		for _, b := range p.parseOr() {
+			children = append(children, b.node())
+		}
+		if node := joinNodes(models.QueryNodeOr, children); node != nil {
+			nodes = append(nodes, node)
+		}
+
+		for _, d := range p.diagnostics {
+			d.Message = fmt.Sprintf("in blacklist entry %q: %s", strings.TrimSpace(entry), d.Message)
+			diagnostics = append(diagnostics, d)
 		}
 	}
 
-	return searchQuery
+	return joinNodes(models.QueryNodeOr, nodes), diagnostics
+}
+
+// RefineQuery narrows a query string with one more filter, such as RefineQuery("cat", "rating", "safe").
+// The query is grouped when appending the filter alone would not narrow it: when it has a top-level
+// OR, or already sets the same filter, which repeating would widen or replace.
+// It returns false if the filter and value don't form a valid filter that can be written back into
+// a query, such as an empty value or one containing whitespace or parentheses.
+func RefineQuery(query, filter, value string) (string, bool) {
+	if value == "" || strings.ContainsFunc(value, func(c rune) bool { return isWhitespace(c) || c == '(' || c == ')' }) {
+		return "", false
+	}
+
+	refinement := "/" + filter + ":" + value
+	added := &models.SearchQuery{}
+	rp := &parser{query: []rune(refinement), pos: 1, global: &models.SearchQuery{}} // Just after the '/'
+	rp.addFilter(added)
+	if len(rp.diagnostics) > 0 || rp.pos != len(rp.query) {
+		return "", false
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return refinement, true
+	}
+
+	p := &parser{query: []rune(query), global: &models.SearchQuery{}}
+	branches := p.parseOr()
+
+	if len(branches) > 1 || (len(branches) == 1 && sharesFilter(branches[0].filters, added)) {
+		return "(" + query + ") " + refinement, true
+	}
+	return query + " " + refinement, true
+}
+
+// sharesFilter reports whether a and b set any of the same filter conditions
+func sharesFilter(a, b *models.SearchQuery) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	va, vb := reflect.ValueOf(*a), reflect.ValueOf(*b)
+	for i := 0; i < va.NumField(); i++ {
+		if !va.Field(i).IsZero() && !vb.Field(i).IsZero() {
+			return true
+		}
+	}
+	return false
 }
@@ -1,135 +1,760 @@
 package ui
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"mybooru/internal/models"
 )
 
+func tagNode(name string) *models.QueryNode {
+	return &models.QueryNode{Kind: models.QueryNodeTag, Value: name}
+}
+
+func wildNode(pattern string) *models.QueryNode {
+	return &models.QueryNode{Kind: models.QueryNodeWildcard, Value: pattern}
+}
+
+func andNode(children ...*models.QueryNode) *models.QueryNode {
+	return &models.QueryNode{Kind: models.QueryNodeAnd, Children: children}
+}
+
+func orNode(children ...*models.QueryNode) *models.QueryNode {
+	return &models.QueryNode{Kind: models.QueryNodeOr, Children: children}
+}
+
+func notNode(child *models.QueryNode) *models.QueryNode {
+	return &models.QueryNode{Kind: models.QueryNodeNot, Children: []*models.QueryNode{child}}
+}
+
+func filterNode(filter *models.SearchQuery) *models.QueryNode {
+	return &models.QueryNode{Kind: models.QueryNodeFilter, Filter: filter}
+}
+
+// formatNode renders an expression tree for readable test failures
+func formatNode(n *models.QueryNode) string {
+	if n == nil {
+		return "<nil>"
+	}
+	switch n.Kind {
+	case models.QueryNodeTag:
+		return n.Value
+	case models.QueryNodeWildcard:
+		return "wild(" + n.Value + ")"
+	case models.QueryNodeNot:
+		return "not(" + formatNode(n.Children[0]) + ")"
+	case models.QueryNodeFilter:
+		return "filter"
+	}
+	name := "and"
+	if n.Kind == models.QueryNodeOr {
+		name = "or"
+	}
+	out := name + "("
+	for i, c := range n.Children {
+		if i > 0 {
+			out += " "
+		}
+		out += formatNode(c)
+	}
+	return out + ")"
+}
+
 func TestParseQuery(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    string
-		expected *models.SearchQuery
+		expected *models.QueryNode
 	}{
 		{
-			name:  "empty query",
-			input: "",
-			expected: &models.SearchQuery{
-				IncludeTags:  nil,
-				OptionalTags: nil,
-				ExcludeTags:  nil,
-			},
+			name:     "empty query",
+			input:    "",
+			expected: nil,
 		},
 		{
-			name:  "single include tag",
-			input: "cat",
-			expected: &models.SearchQuery{
-				IncludeTags:  []string{"cat"},
-				OptionalTags: nil,
-				ExcludeTags:  nil,
-			},
+			name:     "single include tag",
+			input:    "cat",
+			expected: tagNode("cat"),
 		},
 		{
-			name:  "multiple include tags",
-			input: "cat dog bird",
-			expected: &models.SearchQuery{
-				IncludeTags:  []string{"cat", "dog", "bird"},
-				OptionalTags: nil,
-				ExcludeTags:  nil,
-			},
+			name:     "multiple include tags",
+			input:    "cat dog bird",
+			expected: andNode(tagNode("cat"), tagNode("dog"), tagNode("bird")),
 		},
 		{
-			name:  "single exclude tag",
-			input: "-dog",
-			expected: &models.SearchQuery{
-				IncludeTags:  nil,
-				OptionalTags: nil,
-				ExcludeTags:  []string{"dog"},
-			},
+			name:     "single exclude tag",
+			input:    "-dog",
+			expected: notNode(tagNode("dog")),
 		},
 		{
-			name:  "single optional tag",
-			input: "~outdoor",
-			expected: &models.SearchQuery{
-				IncludeTags:  nil,
-				OptionalTags: []string{"outdoor"},
-				ExcludeTags:  nil,
-			},
+			name:     "single optional tag",
+			input:    "~outdoor",
+			expected: tagNode("outdoor"),
 		},
 		{
-			name:  "complex query with all tag types",
-			input: "cat -dog ~outdoor",
-			expected: &models.SearchQuery{
-				IncludeTags:  []string{"cat"},
-				OptionalTags: []string{"outdoor"},
-				ExcludeTags:  []string{"dog"},
-			},
+			name:     "complex query with all tag types",
+			input:    "cat -dog ~outdoor",
+			expected: andNode(tagNode("cat"), notNode(tagNode("dog")), tagNode("outdoor")),
 		},
 		{
 			name:  "multiple tags of each type",
 			input: "cat kitten -dog -wolf ~outdoor ~nature",
-			expected: &models.SearchQuery{
-				IncludeTags:  []string{"cat", "kitten"},
-				OptionalTags: []string{"outdoor", "nature"},
-				ExcludeTags:  []string{"dog", "wolf"},
-			},
+			expected: andNode(
+				tagNode("cat"), tagNode("kitten"), notNode(tagNode("dog")), notNode(tagNode("wolf")),
+				orNode(tagNode("outdoor"), tagNode("nature")),
+			),
 		},
 		{
-			name:  "query with extra whitespace",
-			input: "  cat   -dog    ~outdoor  ",
-			expected: &models.SearchQuery{
-				IncludeTags:  []string{"cat"},
-				OptionalTags: []string{"outdoor"},
-				ExcludeTags:  []string{"dog"},
-			},
+			name:     "query with extra whitespace",
+			input:    "  cat   -dog    ~outdoor  ",
+			expected: andNode(tagNode("cat"), notNode(tagNode("dog")), tagNode("outdoor")),
 		},
 		{
-			name:  "query with tabs and newlines",
-			input: "cat\t-dog\n~outdoor",
-			expected: &models.SearchQuery{
-				IncludeTags:  []string{"cat"},
-				OptionalTags: []string{"outdoor"},
-				ExcludeTags:  []string{"dog"},
-			},
+			name:     "query with tabs and newlines",
+			input:    "cat\t-dog\n~outdoor",
+			expected: andNode(tagNode("cat"), notNode(tagNode("dog")), tagNode("outdoor")),
 		},
 		{
-			name:  "tags with underscores",
-			input: "long_tag another_long_tag",
-			expected: &models.SearchQuery{
-				IncludeTags:  []string{"long_tag", "another_long_tag"},
-				OptionalTags: nil,
-				ExcludeTags:  nil,
-			},
+			name:     "tags with underscores",
+			input:    "long_tag another_long_tag",
+			expected: andNode(tagNode("long_tag"), tagNode("another_long_tag")),
 		},
 		{
 			name:  "mixed order of tag types",
 			input: "~outdoor cat -dog bird ~nature -wolf",
-			expected: &models.SearchQuery{
-				IncludeTags:  []string{"cat", "bird"},
-				OptionalTags: []string{"outdoor", "nature"},
-				ExcludeTags:  []string{"dog", "wolf"},
-			},
+			expected: andNode(
+				tagNode("cat"), notNode(tagNode("dog")), tagNode("bird"), notNode(tagNode("wolf")),
+				orNode(tagNode("outdoor"), tagNode("nature")),
+			),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := ParseQuery(tt.input)
+			result, _ := ParseQuery(tt.input)
 
-			if !reflect.DeepEqual(result.IncludeTags, tt.expected.IncludeTags) {
-				t.Errorf("IncludeTags mismatch:\ngot:  %v\nwant: %v", result.IncludeTags, tt.expected.IncludeTags)
+			if !reflect.DeepEqual(result.Expr, tt.expected) {
+				t.Errorf("Expr mismatch:\ngot:  %s\nwant: %s", formatNode(result.Expr), formatNode(tt.expected))
 			}
+		})
+	}
+}
+
+func TestParseQueryWildcards(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected *models.QueryNode
+	}{
+		{
+			name:     "trailing wildcard",
+			input:    "artist_*",
+			expected: wildNode("artist_*"),
+		},
+		{
+			name:     "leading wildcard keeps the star",
+			input:    "*_hair",
+			expected: wildNode("*_hair"),
+		},
+		{
+			name:     "inner wildcard mixed with tags",
+			input:    "cat blue*eyes",
+			expected: andNode(tagNode("cat"), wildNode("blue*eyes")),
+		},
+		{
+			name:     "excluded wildcard",
+			input:    "cat -*_hair -dog",
+			expected: andNode(tagNode("cat"), notNode(wildNode("*_hair")), notNode(tagNode("dog"))),
+		},
+	}
 
-			if !reflect.DeepEqual(result.OptionalTags, tt.expected.OptionalTags) {
-				t.Errorf("OptionalTags mismatch:\ngot:  %v\nwant: %v", result.OptionalTags, tt.expected.OptionalTags)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := ParseQuery(tt.input)
+
+			if !reflect.DeepEqual(result.Expr, tt.expected) {
+				t.Errorf("Expr mismatch:\ngot:  %s\nwant: %s", formatNode(result.Expr), formatNode(tt.expected))
 			}
+		})
+	}
+}
 
-			if !reflect.DeepEqual(result.ExcludeTags, tt.expected.ExcludeTags) {
-				t.Errorf("ExcludeTags mismatch:\ngot:  %v\nwant: %v", result.ExcludeTags, tt.expected.ExcludeTags)
+func TestParseQueryGrouping(t *testing.T) {
+	explicit := &models.SearchQuery{Rating: []models.Rating{models.RatingExplicit}}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected *models.QueryNode
+	}{
+		{
+			name:     "or keyword",
+			input:    "cat or dog",
+			expected: orNode(tagNode("cat"), tagNode("dog")),
+		},
+		{
+			name:     "pipe operator",
+			input:    "cat | dog",
+			expected: orNode(tagNode("cat"), tagNode("dog")),
+		},
+		{
+			name:     "or binds looser than and",
+			input:    "cat solo OR dog",
+			expected: orNode(andNode(tagNode("cat"), tagNode("solo")), tagNode("dog")),
+		},
+		{
+			name:     "group",
+			input:    "(cat or dog) solo",
+			expected: andNode(orNode(tagNode("cat"), tagNode("dog")), tagNode("solo")),
+		},
+		{
+			name:  "negated group with filter and optional terms",
+			input: "(cat or dog) -(/rating:e ~monochrome ~greyscale)",
+			expected: andNode(
+				orNode(tagNode("cat"), tagNode("dog")),
+				notNode(andNode(orNode(tagNode("monochrome"), tagNode("greyscale")), filterNode(explicit))),
+			),
+		},
+		{
+			name:     "nested negation",
+			input:    "-(cat -(dog))",
+			expected: notNode(andNode(tagNode("cat"), notNode(tagNode("dog")))),
+		},
+		{
+			name:     "negated filter",
+			input:    "cat -/rating:e",
+			expected: andNode(tagNode("cat"), notNode(filterNode(explicit))),
+		},
+		{
+			name:     "parentheses inside tag names",
+			input:    "(miku_(cosplay) or rin_(cosplay))",
+			expected: orNode(tagNode("miku_(cosplay)"), tagNode("rin_(cosplay)")),
+		},
+		{
+			name:     "unclosed group",
+			input:    "(cat or dog",
+			expected: orNode(tagNode("cat"), tagNode("dog")),
+		},
+		{
+			name:     "word containing or is a tag",
+			input:    "orange order",
+			expected: andNode(tagNode("orange"), tagNode("order")),
+		},
+		{
+			name:     "dangling or",
+			input:    "cat or",
+			expected: tagNode("cat"),
+		},
+		{
+			name:     "escaped or is a tag",
+			input:    "cat (~or)",
+			expected: andNode(tagNode("cat"), tagNode("or")),
+		},
+		{
+			name:     "unmatched closing parenthesis is skipped",
+			input:    "cat ) dog",
+			expected: andNode(tagNode("cat"), tagNode("dog")),
+		},
+		{
+			name:  "filters in or branches stay with their branch",
+			input: "cat /rating:e or dog",
+			expected: orNode(
+				andNode(tagNode("cat"), filterNode(explicit)),
+				tagNode("dog"),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := ParseQuery(tt.input)
+
+			if !reflect.DeepEqual(result.Expr, tt.expected) {
+				t.Errorf("Expr mismatch:\ngot:  %s\nwant: %s", formatNode(result.Expr), formatNode(tt.expected))
+			}
+			if len(result.Rating) != 0 {
+				t.Errorf("Rating should not be hoisted out of a group or branch, got %v", result.Rating)
 			}
 		})
 	}
 }
 
+func TestParseQueryTopLevelFilters(t *testing.T) {
+	result, _ := ParseQuery("cat /rating:s /rating:q /minwidth:100 -dog /order:filesize")
+
+	if !reflect.DeepEqual(result.Expr, andNode(tagNode("cat"), notNode(tagNode("dog")))) {
+		t.Errorf("Expr mismatch: got %s", formatNode(result.Expr))
+	}
+	if !reflect.DeepEqual(result.Rating, []models.Rating{models.RatingSafe, models.RatingQuestionable}) {
+		t.Errorf("Rating mismatch: got %v", result.Rating)
+	}
+	if result.MinWidth == nil || *result.MinWidth != 100 {
+		t.Errorf("MinWidth mismatch: got %v", result.MinWidth)
+	}
+	if result.OrderBy != models.SortByFileSize {
+		t.Errorf("OrderBy mismatch: got %q", result.OrderBy)
+	}
+}
+
+func TestParseQueryOrder(t *testing.T) {
+	tests := []struct {
+		input string
+		field models.SortField
+		asc   bool
+		seed  int64
+	}{
+		{input: "", field: "", asc: false},
+		{input: "cat /order:filesize", field: models.SortByFileSize, asc: false},
+		{input: "/order:filesize_asc", field: models.SortByFileSize, asc: true},
+		{input: "/order:mpixels_desc", field: models.SortByPixels, asc: false},
+		{input: "/order:tagcount_asc cat", field: models.SortByTagCount, asc: true},
+		{input: "/order:viewed", field: models.SortByLastViewed, asc: false},
+		{input: "/order:random", field: models.SortByRandom, asc: false},
+		{input: "/order:random:42", field: models.SortByRandom, asc: false, seed: 42},
+		{input: "/order:random_asc:7", field: models.SortByRandom, asc: true, seed: 7},
+		{input: "/order:random:0", field: "", asc: false},
+		{input: "/order:random:2147483647", field: "", asc: false},
+		{input: "/order:filesize:42", field: "", asc: false},
+		{input: "/order:bogus", field: "", asc: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, _ := ParseQuery(tt.input)
+			if result.OrderBy != tt.field || result.OrderAsc != tt.asc || result.RandomSeed != tt.seed {
+				t.Errorf("order mismatch: got (%q, %v, %d), want (%q, %v, %d)",
+					result.OrderBy, result.OrderAsc, result.RandomSeed, tt.field, tt.asc, tt.seed)
+			}
+		})
+	}
+}
+
+func TestParseQueryDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []models.QueryDiagnostic
+	}{
+		{
+			name:     "valid query has no diagnostics",
+			input:    "cat /minwidth:100 /rating:e",
+			expected: nil,
+		},
+		{
+			name:  "non-numeric value",
+			input: "cat /minwidth:abc",
+			expected: []models.QueryDiagnostic{{
+				Offset: 4, Length: 13, Token: "/minwidth:abc",
+				Message: `invalid value "abc" for /minwidth, expected a whole number`,
+			}},
+		},
+		{
+			name:  "misspelled filter",
+			input: "/raiting:e",
+			expected: []models.QueryDiagnostic{{
+				Offset: 0, Length: 10, Token: "/raiting:e",
+				Message: "unknown filter /raiting", Suggestion: "/rating:e",
+			}},
+		},
+		{
+			name:  "misspelled value",
+			input: "/rating:explict",
+			expected: []models.QueryDiagnostic{{
+				Offset: 0, Length: 15, Token: "/rating:explict",
+				Message:    `invalid value "explict" for /rating, expected one of: safe, questionable, explicit, s, q, e`,
+				Suggestion: "/rating:explicit",
+			}},
+		},
+		{
+			name:  "unknown filter without close match",
+			input: "dog /zzzzzz",
+			expected: []models.QueryDiagnostic{{
+				Offset: 4, Length: 7, Token: "/zzzzzz",
+				Message: "unknown filter /zzzzzz",
+			}},
+		},
+		{
+			name:  "offsets are counted in runes",
+			input: "猫 /type:vidoe",
+			expected: []models.QueryDiagnostic{{
+				Offset: 2, Length: 11, Token: "/type:vidoe",
+				Message:    `invalid value "vidoe" for /type, expected one of: image, video, audio`,
+				Suggestion: "/type:video",
+			}},
+		},
+		{
+			name:  "unclosed group",
+			input: "(cat or dog",
+			expected: []models.QueryDiagnostic{{
+				Offset: 0, Length: 11, Token: "(cat or dog",
+				Message: "missing closing ')' for group", Suggestion: "(cat or dog)",
+			}},
+		},
+		{
+			name:  "lone or",
+			input: "or",
+			expected: []models.QueryDiagnostic{{
+				Offset: 0, Length: 2, Token: "or",
+				Message: `"or" needs a term on each side; write (~or) to search for a tag named or`,
+			}},
+		},
+		{
+			name:  "trailing or",
+			input: "cat OR",
+			expected: []models.QueryDiagnostic{{
+				Offset: 4, Length: 2, Token: "OR",
+				Message: `"OR" needs a term on each side; write (~or) to search for a tag named or`,
+			}},
+		},
+		{
+			name:  "doubled pipe",
+			input: "cat | | dog",
+			expected: []models.QueryDiagnostic{{
+				Offset: 6, Length: 1, Token: "|",
+				Message: `"|" needs a term on each side`,
+			}},
+		},
+		{
+			name:  "dangling or in group",
+			input: "(cat or) dog",
+			expected: []models.QueryDiagnostic{{
+				Offset: 5, Length: 2, Token: "or",
+				Message: `"or" needs a term on each side; write (~or) to search for a tag named or`,
+			}},
+		},
+		{
+			name:  "unmatched closing parenthesis",
+			input: "cat )",
+			expected: []models.QueryDiagnostic{{
+				Offset: 4, Length: 1, Token: ")",
+				Message: "unmatched ')'",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diagnostics := ParseQuery(tt.input)
+
+			if !reflect.DeepEqual(diagnostics, tt.expected) {
+				t.Errorf("diagnostics mismatch:\ngot:  %+v\nwant: %+v", diagnostics, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseQueryIgnoresInvalidFilters(t *testing.T) {
+	result, diagnostics := ParseQuery("cat /minwidth:abc /raiting:e")
+
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", diagnostics)
+	}
+	if result.MinWidth != nil || result.Rating != nil {
+		t.Errorf("invalid filters should not set conditions, got MinWidth=%v Rating=%v", result.MinWidth, result.Rating)
+	}
+	if !reflect.DeepEqual(result.Expr, tagNode("cat")) {
+		t.Errorf("Expr mismatch: got %s", formatNode(result.Expr))
+	}
+}
+
+func TestParseQueryDateFilters(t *testing.T) {
+	result, diagnostics := ParseQuery("/date:>=2024-01 /date:<2025 /viewed:never")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+	assertTimePtr(t, "CreatedAfter", result.CreatedAfter, localTime(2024, 1, 1, 0, 0, 0))
+	assertTimePtr(t, "CreatedBefore", result.CreatedBefore, localTime(2024, 12, 31, 23, 59, 59))
+	if result.Viewed == nil || *result.Viewed {
+		t.Errorf("Viewed should be false, got %v", result.Viewed)
+	}
+
+	result, _ = ParseQuery("/viewed:2024-05")
+	assertTimePtr(t, "ViewedAfter", result.ViewedAfter, localTime(2024, 5, 1, 0, 0, 0))
+	assertTimePtr(t, "ViewedBefore", result.ViewedBefore, localTime(2024, 5, 31, 23, 59, 59))
+
+	_, diagnostics = ParseQuery("/age:soon /date:tomorrow")
+	if len(diagnostics) != 2 {
+		t.Errorf("expected 2 diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestParseQueryDimensionFilters(t *testing.T) {
+	result, diagnostics := ParseQuery("/duration:1m..5m /ratio:>1 /mpixels:>4")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+	assertFloatPtr(t, "MinDuration", result.MinDuration, floatPtr(60))
+	assertFloatPtr(t, "MaxDuration", result.MaxDuration, floatPtr(300))
+	assertFloatPtr(t, "MinRatio", result.MinRatio, floatPtr(1+ratioTolerance))
+	assertFloatPtr(t, "MaxRatio", result.MaxRatio, nil)
+	assertFloatPtr(t, "MinMegapixels", result.MinMegapixels, floatPtr(4))
+	assertFloatPtr(t, "MaxMegapixels", result.MaxMegapixels, nil)
+
+	_, diagnostics = ParseQuery("/duration:forever /ratio:wide /mpixels:many")
+	if len(diagnostics) != 3 {
+		t.Errorf("expected 3 diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestParseQueryIdentityFilters(t *testing.T) {
+	hash := "0123456789abcdef0123456789abcdef"
+	result, diagnostics := ParseQuery("/id:100..200 /md5:0123456789ABCDEF0123456789ABCDEF.webm /ext:.WebM /codec:H265 /codec:vp9 /mime:video/hevc")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+	if result.MinID == nil || *result.MinID != 100 || result.MaxID == nil || *result.MaxID != 200 {
+		t.Errorf("ID bounds mismatch: got %v..%v", result.MinID, result.MaxID)
+	}
+	if !reflect.DeepEqual(result.MD5s, []string{hash}) {
+		t.Errorf("MD5s mismatch: got %v", result.MD5s)
+	}
+	if !reflect.DeepEqual(result.Extensions, []string{"webm"}) {
+		t.Errorf("Extensions mismatch: got %v", result.Extensions)
+	}
+	if !reflect.DeepEqual(result.Codecs, []string{"hevc", "vp9"}) {
+		t.Errorf("Codecs mismatch: got %v", result.Codecs)
+	}
+	if !reflect.DeepEqual(result.MimeTypes, []string{"video/hevc"}) {
+		t.Errorf("MimeTypes mismatch: got %v", result.MimeTypes)
+	}
+
+	result, _ = ParseQuery("/id:>41")
+	if result.MinID == nil || *result.MinID != 42 || result.MaxID != nil {
+		t.Errorf("/id:>41 should give 42.., got %v..%v", result.MinID, result.MaxID)
+	}
+	result, _ = ParseQuery("/id:7")
+	if result.MinID == nil || *result.MinID != 7 || result.MaxID == nil || *result.MaxID != 7 {
+		t.Errorf("/id:7 should match exactly, got %v..%v", result.MinID, result.MaxID)
+	}
+
+	_, diagnostics = ParseQuery("/id:abc /md5:1234 /codec: /mime:video /ext:")
+	if len(diagnostics) != 5 {
+		t.Errorf("expected 5 diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestParseQueryTagCountFilters(t *testing.T) {
+	result, diagnostics := ParseQuery("/tagcount:<3 /arttags:0 /chartags:>=1 /gentags:2..5")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+
+	artist := models.TagCategoryArtist
+	character := models.TagCategoryCharacter
+	general := models.TagCategoryGeneral
+	two, zero, one, five := 2, 0, 1, 5
+
+	want := []models.TagCountFilter{
+		{Max: &two},
+		{Category: &artist, Min: &zero, Max: &zero},
+		{Category: &character, Min: &one},
+		{Category: &general, Min: &two, Max: &five},
+	}
+	if !reflect.DeepEqual(result.TagCounts, want) {
+		t.Errorf("TagCounts mismatch:\ngot:  %s\nwant: %s", formatTagCounts(result.TagCounts), formatTagCounts(want))
+	}
+
+	_, diagnostics = ParseQuery("/tagcount:1.5 /arttags:-1 /metatags:some")
+	if len(diagnostics) != 3 {
+		t.Errorf("expected 3 diagnostics, got %+v", diagnostics)
+	}
+}
+
+func formatTagCounts(filters []models.TagCountFilter) string {
+	deref := func(v interface{}) string {
+		switch p := v.(type) {
+		case *int:
+			if p != nil {
+				return fmt.Sprint(*p)
+			}
+		case *models.TagCategory:
+			if p != nil {
+				return fmt.Sprint(*p)
+			}
+		}
+		return "nil"
+	}
+
+	var parts []string
+	for _, f := range filters {
+		parts = append(parts, fmt.Sprintf("{%s %s..%s}", deref(f.Category), deref(f.Min), deref(f.Max)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParseQuerySavedSearches(t *testing.T) {
+	saved := map[string]string{
+		"cats":    "cat -dog",
+		"wide":    "/ratio:>1 /order:width",
+		"pets":    "/saved:cats or bird",
+		"loop":    "cat /saved:loop",
+		"broken":  "/rating:x",
+		"nothing": "",
+	}
+	resolve := func(name string) (string, bool) {
+		q, ok := saved[strings.ToLower(name)]
+		return q, ok
+	}
+
+	result, diagnostics := ParseQueryWithSavedSearches("/saved:Cats bird", resolve)
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+	want := andNode(andNode(tagNode("cat"), notNode(tagNode("dog"))), tagNode("bird"))
+	if !reflect.DeepEqual(result.Expr, want) {
+		t.Errorf("Expr mismatch:\ngot:  %s\nwant: %s", formatNode(result.Expr), formatNode(want))
+	}
+
+	result, _ = ParseQueryWithSavedSearches("-/saved:pets", resolve)
+	want = notNode(orNode(andNode(tagNode("cat"), notNode(tagNode("dog"))), tagNode("bird")))
+	if !reflect.DeepEqual(result.Expr, want) {
+		t.Errorf("nested Expr mismatch:\ngot:  %s\nwant: %s", formatNode(result.Expr), formatNode(want))
+	}
+
+	result, _ = ParseQueryWithSavedSearches("cat /saved:wide", resolve)
+	if result.OrderBy != models.SortByWidth {
+		t.Errorf("saved order should apply when the query has none, got %q", result.OrderBy)
+	}
+	if result.Expr == nil || len(result.Expr.Children) != 2 || result.Expr.Children[1].Kind != models.QueryNodeFilter {
+		t.Errorf("saved filters should be expanded as a filter node, got %s", formatNode(result.Expr))
+	}
+	result, _ = ParseQueryWithSavedSearches("/order:id /saved:wide", resolve)
+	if result.OrderBy != models.SortByID {
+		t.Errorf("query order should win over saved order, got %q", result.OrderBy)
+	}
+
+	tests := []struct {
+		query   string
+		message string
+	}{
+		{query: "/saved:missing", message: `unknown saved search "missing"`},
+		{query: "/saved:loop", message: `in saved search "loop": saved search "loop" refers to itself`},
+		{query: "/saved:broken", message: `in saved search "broken": invalid value "x" for /rating`},
+		{query: "/saved:", message: "missing saved search name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, diagnostics := ParseQueryWithSavedSearches(tt.query, resolve)
+			if len(diagnostics) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %+v", diagnostics)
+			}
+			if !strings.HasPrefix(diagnostics[0].Message, tt.message) {
+				t.Errorf("message mismatch: got %q, want prefix %q", diagnostics[0].Message, tt.message)
+			}
+			if diagnostics[0].Offset != 0 {
+				t.Errorf("diagnostic should point at the reference, got offset %d", diagnostics[0].Offset)
+			}
+		})
+	}
+
+	_, diagnostics = ParseQuery("/saved:cats")
+	if len(diagnostics) != 1 {
+		t.Errorf("saved searches should be reported as unavailable without a resolver, got %+v", diagnostics)
+	}
+}
+
+func TestParseTagTerms(t *testing.T) {
+	got := ParseTagTerms("cat -dog ~fox -(bird -owl) blue_* /rating:s ねこ")
+	want := []TagTerm{
+		{Name: "cat", Offset: 0, Length: 3},
+		{Name: "dog", Offset: 5, Length: 3, Negated: true},
+		{Name: "fox", Offset: 10, Length: 3},
+		{Name: "bird", Offset: 16, Length: 4, Negated: true},
+		{Name: "owl", Offset: 22, Length: 3},
+		{Name: "ねこ", Offset: 44, Length: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTagTerms mismatch:\ngot:  %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestParseBlacklist(t *testing.T) {
+	node, diagnostics := ParseBlacklist([]string{"gore", "  ", "spider -cartoon"})
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+	want := orNode(tagNode("gore"), andNode(tagNode("spider"), notNode(tagNode("cartoon"))))
+	if !reflect.DeepEqual(node, want) {
+		t.Errorf("blacklist mismatch:\ngot:  %s\nwant: %s", formatNode(node), formatNode(want))
+	}
+
+	node, _ = ParseBlacklist(nil)
+	if node != nil {
+		t.Errorf("empty blacklist should give a nil expression, got %s", formatNode(node))
+	}
+
+	_, diagnostics = ParseBlacklist([]string{"cat /rating:x"})
+	if len(diagnostics) != 1 || !strings.HasPrefix(diagnostics[0].Message, `in blacklist entry "cat /rating:x": `) {
+		t.Errorf("expected a diagnostic naming the entry, got %+v", diagnostics)
+	}
+}
+
+func TestParseQueryBlacklistOverride(t *testing.T) {
+	result, diagnostics := ParseQuery("cat /blacklist:off")
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %+v", diagnostics)
+	}
+	if !result.IgnoreBlacklist {
+		t.Error("/blacklist:off should set IgnoreBlacklist")
+	}
+	if !reflect.DeepEqual(result.Expr, tagNode("cat")) {
+		t.Errorf("Expr mismatch: got %s", formatNode(result.Expr))
+	}
+
+	result, _ = ParseQuery("(cat /blacklist:off) | dog")
+	if !result.IgnoreBlacklist {
+		t.Error("/blacklist:off should apply to the whole query from inside a group")
+	}
+
+	result, _ = ParseQuery("/blacklist:off /blacklist:on")
+	if result.IgnoreBlacklist {
+		t.Error("the last /blacklist: should win")
+	}
+
+	_, diagnostics = ParseQuery("/blacklist:maybe")
+	if len(diagnostics) != 1 {
+		t.Errorf("expected 1 diagnostic, got %+v", diagnostics)
+	}
+}
+
+func TestRefineQuery(t *testing.T) {
+	tests := []struct {
+		query, filter, value string
+		want                 string
+	}{
+		{"", "rating", "safe", "/rating:safe"},
+		{"  cat  ", "rating", "safe", "cat /rating:safe"},
+		{"cat /type:video", "rating", "safe", "cat /type:video /rating:safe"},
+		{"cat /rating:safe /rating:questionable", "rating", "safe", "(cat /rating:safe /rating:questionable) /rating:safe"},
+		{"cat | dog", "ext", "png", "(cat | dog) /ext:png"},
+		{"cat /favorite:true", "favorite", "false", "(cat /favorite:true) /favorite:false"},
+		{"~cat ~dog", "type", "image", "~cat ~dog /type:image"},
+	}
+
+	for _, tt := range tests {
+		got, ok := RefineQuery(tt.query, tt.filter, tt.value)
+		if !ok || got != tt.want {
+			t.Errorf("RefineQuery(%q, %q, %q) = %q, %v, want %q", tt.query, tt.filter, tt.value, got, ok, tt.want)
+		}
+	}
+
+	rejected := []struct {
+		name, filter, value string
+	}{
+		{"empty value", "ext", ""},
+		{"invalid value", "rating", "bogus"},
+		{"unknown filter", "bogus", "png"},
+		{"value with a space", "ext", "png jpg"},
+		{"value with a parenthesis", "ext", "png)"},
+	}
+
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := RefineQuery("cat", tt.filter, tt.value); ok {
+				t.Errorf("RefineQuery(%q, %q, %q) = %q, want rejection", "cat", tt.filter, tt.value, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package ui
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ratioTolerance is the relative tolerance for aspect ratio filters, so that
+// 1920x1080 and 1366x768 both count as 16:9
+const ratioTolerance = 0.01
+
+// parseRange parses a comparison or range such as >30, <=5, 10..20 or 42 into inclusive bounds,
+// either of which may be nil. Strict comparisons are tightened by step, so with a step of 1
+// <3 becomes <=2 for whole numbers; with a step of 0 they are treated as inclusive.
+func parseRange(s string, parseValue func(string) (float64, bool), step float64) (min, max *float64, ok bool) {
+	if from, to, isRange := strings.Cut(s, ".."); isRange {
+		if from == "" && to == "" {
+			return nil, nil, false
+		}
+		if from != "" {
+			v, valid := parseValue(from)
+			if !valid {
+				return nil, nil, false
+			}
+			min = &v
+		}
+		if to != "" {
+			v, valid := parseValue(to)
+			if !valid {
+				return nil, nil, false
+			}
+			max = &v
+		}
+		if min != nil && max != nil && *min > *max {
+			min, max = max, min
+		}
+		return min, max, true
+	}
+
+	op, operand := splitComparison(s)
+	v, valid := parseValue(operand)
+	if !valid {
+		return nil, nil, false
+	}
+
+	switch op {
+	case ">":
+		v += step
+		return &v, nil, true
+	case ">=":
+		return &v, nil, true
+	case "<":
+		v -= step
+		return nil, &v, true
+	case "<=":
+		return nil, &v, true
+	default:
+		exact := v
+		return &v, &exact, true
+	}
+}
+
+// parseDecimal parses a non-negative decimal number
+func parseDecimal(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// parseWholeNumber parses a non-negative integer
+func parseWholeNumber(s string) (float64, bool) {
+	v, err := strconv.ParseUint(s, 10, 31)
+	if err != nil {
+		return 0, false
+	}
+	return float64(v), true
+}
+
+// parseID parses a media ID, capped so that it stays exact as a float64
+func parseID(s string) (float64, bool) {
+	v, err := strconv.ParseUint(s, 10, 53)
+	if err != nil {
+		return 0, false
+	}
+	return float64(v), true
+}
+
+// int64Ptr converts a bound produced by parseRange with parseID back to an integer
+func int64Ptr(f *float64) *int64 {
+	if f == nil {
+		return nil
+	}
+	v := int64(*f)
+	return &v
+}
+
+// intPtr converts a bound produced by parseRange with parseWholeNumber back to an integer
+func intPtr(f *float64) *int {
+	if f == nil {
+		return nil
+	}
+	v := int(*f)
+	return &v
+}
+
+// parseSeconds parses a duration such as 90, 30s, 1m30s or 1.5h into seconds.
+// Plain numbers are taken as seconds.
+func parseSeconds(s string) (float64, bool) {
+	if v, ok := parseDecimal(s); ok {
+		return v, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, false
+	}
+	return d.Seconds(), true
+}
+
+// parseRatio parses an aspect ratio written as 16:9, 16/9 or 1.78
+func parseRatio(s string) (float64, bool) {
+	sep := strings.IndexAny(s, ":/")
+	if sep < 0 {
+		v, ok := parseDecimal(s)
+		return v, ok && v > 0
+	}
+
+	w, okW := parseDecimal(s[:sep])
+	h, okH := parseDecimal(s[sep+1:])
+	if !okW || !okH || w == 0 || h == 0 {
+		return 0, false
+	}
+	return w / h, true
+}
+
+// parseDurationRange parses a /duration: value. An exact duration matches anything
+// that rounds to it, since stored durations are fractional.
+func parseDurationRange(s string) (min, max *float64, ok bool) {
+	min, max, ok = parseRange(s, parseSeconds, 0)
+	if ok && min != nil && max != nil && *min == *max {
+		lo, hi := *min-0.5, *max+0.5
+		min, max = &lo, &hi
+	}
+	return min, max, ok
+}
+
+// parseRatioRange parses a /ratio: value, applying ratioTolerance so that exact ratios
+// match close dimensions and strict comparisons such as >1 exclude near-square media
+func parseRatioRange(s string) (min, max *float64, ok bool) {
+	if _, _, isRange := strings.Cut(s, ".."); isRange {
+		return parseRange(s, parseRatio, 0)
+	}
+
+	op, operand := splitComparison(s)
+	v, valid := parseRatio(operand)
+	if !valid {
+		return nil, nil, false
+	}
+
+	lo, hi := v*(1-ratioTolerance), v*(1+ratioTolerance)
+	switch op {
+	case ">":
+		return &hi, nil, true
+	case ">=":
+		return &lo, nil, true
+	case "<":
+		return nil, &lo, true
+	case "<=":
+		return nil, &hi, true
+	default:
+		return &lo, &hi, true
+	}
+}
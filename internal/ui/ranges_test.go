@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"math"
+	"testing"
+)
+
+func assertFloatPtr(t *testing.T, label string, got, want *float64) {
+	t.Helper()
+	if (got == nil) != (want == nil) || (got != nil && math.Abs(*got-*want) > 1e-9) {
+		t.Errorf("%s mismatch: got %v, want %v", label, formatFloatPtr(got), formatFloatPtr(want))
+	}
+}
+
+func formatFloatPtr(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input string
+		step  float64
+		min   *float64
+		max   *float64
+		ok    bool
+	}{
+		{input: "4", min: floatPtr(4), max: floatPtr(4), ok: true},
+		{input: ">4", min: floatPtr(4), ok: true},
+		{input: ">4", step: 1, min: floatPtr(5), ok: true},
+		{input: ">=4", step: 1, min: floatPtr(4), ok: true},
+		{input: "<3", step: 1, max: floatPtr(2), ok: true},
+		{input: "<=3", step: 1, max: floatPtr(3), ok: true},
+		{input: "1..8", min: floatPtr(1), max: floatPtr(8), ok: true},
+		{input: "8..1", min: floatPtr(1), max: floatPtr(8), ok: true},
+		{input: "2.5..", min: floatPtr(2.5), ok: true},
+		{input: "..2.5", max: floatPtr(2.5), ok: true},
+		{input: "..", ok: false},
+		{input: "big", ok: false},
+		{input: ">-1", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			min, max, ok := parseRange(tt.input, parseDecimal, tt.step)
+			if ok != tt.ok {
+				t.Fatalf("ok mismatch: got %v, want %v", ok, tt.ok)
+			}
+			assertFloatPtr(t, "min", min, tt.min)
+			assertFloatPtr(t, "max", max, tt.max)
+		})
+	}
+}
+
+func TestParseDurationRange(t *testing.T) {
+	tests := []struct {
+		input string
+		min   *float64
+		max   *float64
+		ok    bool
+	}{
+		{input: ">30s", min: floatPtr(30), ok: true},
+		{input: ">30", min: floatPtr(30), ok: true},
+		{input: "1m..5m", min: floatPtr(60), max: floatPtr(300), ok: true},
+		{input: "<1m30s", max: floatPtr(90), ok: true},
+		{input: "<=1.5h", max: floatPtr(5400), ok: true},
+		{input: "90", min: floatPtr(89.5), max: floatPtr(90.5), ok: true},
+		{input: "long", ok: false},
+		{input: "5x", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			min, max, ok := parseDurationRange(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("ok mismatch: got %v, want %v", ok, tt.ok)
+			}
+			assertFloatPtr(t, "min", min, tt.min)
+			assertFloatPtr(t, "max", max, tt.max)
+		})
+	}
+}
+
+func TestParseRatioRange(t *testing.T) {
+	wide := 16.0 / 9.0
+
+	tests := []struct {
+		input string
+		min   *float64
+		max   *float64
+		ok    bool
+	}{
+		{input: "16:9", min: floatPtr(wide * (1 - ratioTolerance)), max: floatPtr(wide * (1 + ratioTolerance)), ok: true},
+		{input: "16/9", min: floatPtr(wide * (1 - ratioTolerance)), max: floatPtr(wide * (1 + ratioTolerance)), ok: true},
+		{input: ">1", min: floatPtr(1 + ratioTolerance), ok: true},
+		{input: ">=1", min: floatPtr(1 - ratioTolerance), ok: true},
+		{input: "<1", max: floatPtr(1 - ratioTolerance), ok: true},
+		{input: "1.5..2", min: floatPtr(1.5), max: floatPtr(2), ok: true},
+		{input: "4:3..16:9", min: floatPtr(4.0 / 3.0), max: floatPtr(wide), ok: true},
+		{input: "16:0", ok: false},
+		{input: "0", ok: false},
+		{input: "wide", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			min, max, ok := parseRatioRange(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("ok mismatch: got %v, want %v", ok, tt.ok)
+			}
+			assertFloatPtr(t, "min", min, tt.min)
+			assertFloatPtr(t, "max", max, tt.max)
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package ui
+
+import (
+	"strings"
+
+	"mybooru/internal/editdist"
+)
+
+// maxSuggestionDistance is the largest edit distance for which a word is still offered as a correction
+const maxSuggestionDistance = 2
+
+// closestMatch returns the candidate closest to word by edit distance,
+// or false if none is within maxSuggestionDistance
+func closestMatch(word string, candidates []string) (string, bool) {
+	w := []rune(strings.ToLower(word))
+	best := ""
+	bestDistance := maxSuggestionDistance + 1
+	for _, candidate := range candidates {
+		if d := editdist.Distance(w, []rune(candidate), maxSuggestionDistance); d < bestDistance {
+			best = candidate
+			bestDistance = d
+		}
+	}
+	return best, bestDistance <= maxSuggestionDistance
+}
@@ -0,0 +1,17 @@
+package ui
+
+import "testing"
+
+func TestClosestMatch(t *testing.T) {
+	candidates := []string{"minwidth", "maxwidth", "rating"}
+
+	if got, ok := closestMatch("minwdth", candidates); !ok || got != "minwidth" {
+		t.Errorf("closestMatch(minwdth) = %q, %v", got, ok)
+	}
+	if got, ok := closestMatch("RATNG", candidates); !ok || got != "rating" {
+		t.Errorf("closestMatch(RATNG) = %q, %v", got, ok)
+	}
+	if _, ok := closestMatch("favorite", candidates); ok {
+		t.Errorf("closestMatch(favorite) should not match")
+	}
+}
@@ -63,6 +63,7 @@ func ValidateTagName(name string) error {
 
 // ParseTags takes in a raw string and returns an array of tags ready to be inserted in the database.
 // Expected format: "tag_one artist:artist_name tag_two"
+// Tags with a category prefix are marked ExplicitCategory, so an existing general tag is moved to that category.
 // Returns error if any tag has restricted characters at start/end.
 func ParseTags(tagString string) ([]models.CreateTagInput, error) {
 	tagString = strings.ToLower(strings.TrimSpace(tagString))
@@ -82,6 +83,7 @@ func ParseTags(tagString string) ([]models.CreateTagInput, error) {
 
 		var name string
 		var category models.TagCategory
+		var explicit bool
 
 		if strings.Contains(tag, ":") {
 			// Split on FIRST colon only to preserve colons in tag names
@@ -99,6 +101,7 @@ func ParseTags(tagString string) ([]models.CreateTagInput, error) {
 
 			name = nameStr
 			category = ParseCategory(categoryStr)
+			explicit = true
 		} else {
 			if err := ValidateTagName(tag); err != nil {
 				return nil, err
@@ -109,10 +112,52 @@ func ParseTags(tagString string) ([]models.CreateTagInput, error) {
 		}
 
 		tags = append(tags, models.CreateTagInput{
-			Name:     name,
-			Category: category,
+			Name:             name,
+			Category:         category,
+			ExplicitCategory: explicit,
 		})
 	}
 
 	return tags, nil
 }
+
+// ParseTagDelta parses a bulk tag edit such as "+landscape -wip artist:foo". Tags prefixed with
+// - are removed and the rest, with or without a leading +, are added.
+// Returns error if a tag is invalid or is both added and removed.
+func ParseTagDelta(delta string) (models.TagDelta, error) {
+	var addList, removeList []string
+	for _, token := range strings.Fields(delta) {
+		switch token[0] {
+		case '-':
+			removeList = append(removeList, token[1:])
+		case '+':
+			addList = append(addList, token[1:])
+		default:
+			addList = append(addList, token)
+		}
+	}
+
+	add, err := ParseTags(strings.Join(addList, " "))
+	if err != nil {
+		return models.TagDelta{}, err
+	}
+	removed, err := ParseTags(strings.Join(removeList, " "))
+	if err != nil {
+		return models.TagDelta{}, err
+	}
+
+	adding := make(map[string]bool, len(add))
+	for _, tag := range add {
+		adding[tag.Name] = true
+	}
+
+	remove := make([]string, 0, len(removed))
+	for _, tag := range removed {
+		if adding[tag.Name] {
+			return models.TagDelta{}, fmt.Errorf("tag '%s' cannot be both added and removed", tag.Name)
+		}
+		remove = append(remove, tag.Name)
+	}
+
+	return models.TagDelta{Add: add, Remove: remove}, nil
+}
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"mybooru/internal/models"
+	"reflect"
 	"testing"
 )
 
@@ -65,14 +66,14 @@ func TestParseTags(t *testing.T) {
 			name:  "tag with artist category",
 			input: "artist:john_doe",
 			expected: []models.CreateTagInput{
-				{Name: "john_doe", Category: models.TagCategoryArtist},
+				{Name: "john_doe", Category: models.TagCategoryArtist, ExplicitCategory: true},
 			},
 		},
 		{
 			name:  "tag with multiple colons",
 			input: "artist:tag:with:colons",
 			expected: []models.CreateTagInput{
-				{Name: "tag:with:colons", Category: models.TagCategoryArtist},
+				{Name: "tag:with:colons", Category: models.TagCategoryArtist, ExplicitCategory: true},
 			},
 		},
 		{
@@ -80,8 +81,8 @@ func TestParseTags(t *testing.T) {
 			input: "cat artist:john_doe character:hero",
 			expected: []models.CreateTagInput{
 				{Name: "cat", Category: models.TagCategoryGeneral},
-				{Name: "john_doe", Category: models.TagCategoryArtist},
-				{Name: "hero", Category: models.TagCategoryCharacter},
+				{Name: "john_doe", Category: models.TagCategoryArtist, ExplicitCategory: true},
+				{Name: "hero", Category: models.TagCategoryCharacter, ExplicitCategory: true},
 			},
 		},
 		{
@@ -92,6 +93,13 @@ func TestParseTags(t *testing.T) {
 				{Name: "dog", Category: models.TagCategoryGeneral},
 			},
 		},
+		{
+			name:  "explicit general category",
+			input: "general:cat",
+			expected: []models.CreateTagInput{
+				{Name: "cat", Category: models.TagCategoryGeneral, ExplicitCategory: true},
+			},
+		},
 		{
 			name:     "empty string",
 			input:    "",
@@ -114,14 +122,14 @@ func TestParseTags(t *testing.T) {
 			name:  "uppercase category",
 			input: "ARTIST:john_doe",
 			expected: []models.CreateTagInput{
-				{Name: "john_doe", Category: models.TagCategoryArtist},
+				{Name: "john_doe", Category: models.TagCategoryArtist, ExplicitCategory: true},
 			},
 		},
 		{
 			name:  "series category alias",
 			input: "series:pokemon",
 			expected: []models.CreateTagInput{
-				{Name: "pokemon", Category: models.TagCategoryCopyright},
+				{Name: "pokemon", Category: models.TagCategoryCopyright, ExplicitCategory: true},
 			},
 		},
 		{
@@ -181,6 +189,9 @@ func TestParseTags(t *testing.T) {
 				if tag.Category != tt.expected[i].Category {
 					t.Errorf("ParseTags(%q)[%d].Category = %d, want %d", tt.input, i, tag.Category, tt.expected[i].Category)
 				}
+				if tag.ExplicitCategory != tt.expected[i].ExplicitCategory {
+					t.Errorf("ParseTags(%q)[%d].ExplicitCategory = %v, want %v", tt.input, i, tag.ExplicitCategory, tt.expected[i].ExplicitCategory)
+				}
 			}
 		})
 	}
@@ -216,6 +227,75 @@ func TestParseCategory(t *testing.T) {
 	}
 }
 
+func TestParseTagDelta(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    models.TagDelta
+		expectError bool
+	}{
+		{
+			name:  "additions and removals",
+			input: "+landscape -wip artist:foo",
+			expected: models.TagDelta{
+				Add: []models.CreateTagInput{
+					{Name: "landscape", Category: models.TagCategoryGeneral},
+					{Name: "foo", Category: models.TagCategoryArtist, ExplicitCategory: true},
+				},
+				Remove: []string{"wip"},
+			},
+		},
+		{
+			name:  "removal with category prefix",
+			input: "-artist:foo",
+			expected: models.TagDelta{
+				Add:    []models.CreateTagInput{},
+				Remove: []string{"foo"},
+			},
+		},
+		{
+			name:  "extra whitespace",
+			input: "  +cat\t-dog  ",
+			expected: models.TagDelta{
+				Add:    []models.CreateTagInput{{Name: "cat", Category: models.TagCategoryGeneral}},
+				Remove: []string{"dog"},
+			},
+		},
+		{
+			name:        "tag both added and removed",
+			input:       "cat -cat",
+			expectError: true,
+		},
+		{
+			name:        "invalid removed tag",
+			input:       "--wip",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseTagDelta(tt.input)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ParseTagDelta(%q) expected error, got nil", tt.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("ParseTagDelta(%q) unexpected error: %v", tt.input, err)
+				return
+			}
+
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ParseTagDelta(%q) = %+v, want %+v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestIsWhitespace(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,30 @@
+// Package uitest provides helpers for testing code that works with search query strings
+package uitest
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// RandomQuery builds a random query string from the given tags and filters, nesting groups and
+// OR branches up to depth levels deep. Tags and groups may be negated or made optional. Every
+// operand has at least one term, so the query only has diagnostics if its terms do.
+func RandomQuery(rng *rand.Rand, depth int, tags, filters []string) string {
+	var terms []string
+	for n := 1 + rng.Intn(3); n > 0; n-- {
+		prefix := []string{"", "", "-", "~"}[rng.Intn(4)]
+		switch r := rng.Intn(10); {
+		case r < 5:
+			terms = append(terms, prefix+tags[rng.Intn(len(tags))])
+		case r < 8 || depth == 0:
+			terms = append(terms, filters[rng.Intn(len(filters))])
+		default:
+			terms = append(terms, prefix+"("+RandomQuery(rng, depth-1, tags, filters)+")")
+		}
+	}
+	query := strings.Join(terms, " ")
+	if depth > 0 && rng.Intn(3) == 0 {
+		query += []string{" or ", " | "}[rng.Intn(2)] + RandomQuery(rng, depth-1, tags, filters)
+	}
+	return query
+}